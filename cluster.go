@@ -0,0 +1,176 @@
+package groclick
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/godepo/groclick/internal/pkg/sqltoken"
+)
+
+const (
+	defaultClusterDDLTimeout = time.Minute
+	clusterDDLPollInterval   = 100 * time.Millisecond
+)
+
+var ErrClusterDDLTimeout = errors.New("distributed ddl is not finished in time")
+
+type distributedDDLStatus struct {
+	Pending uint64 `ch:"pending"`
+}
+
+func WithCluster(cluster string) Option {
+	return func(c *config) {
+		c.cluster = cluster
+	}
+}
+
+func WithClusterDDLTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.clusterDDLTimeout = timeout
+	}
+}
+
+func onClusterClause(cluster string) string {
+	if cluster == "" {
+		return ""
+	}
+
+	return " ON CLUSTER " + quoteString(cluster)
+}
+
+func onCluster(statement, cluster string) string {
+	if cluster == "" {
+		return statement
+	}
+
+	tokens := sqltoken.Tokenize(statement)
+	words := sqltoken.Significant(tokens)
+
+	for i := 0; i+1 < len(words); i++ {
+		if tokens[words[i]].Is("ON") && tokens[words[i+1]].Is("CLUSTER") {
+			return statement
+		}
+	}
+
+	at, ok := clusterClausePosition(tokens, words)
+	if !ok {
+		return statement
+	}
+
+	if at == len(tokens) {
+		return sqltoken.Join(tokens) + onClusterClause(cluster)
+	}
+
+	return sqltoken.Join(tokens[:at]) + onClusterClause(cluster) + sqltoken.Join(tokens[at:])
+}
+
+func clusterClausePosition(tokens []sqltoken.Token, words []int) (int, bool) {
+	pos := 0
+	skip := func(keywords ...string) bool {
+		if pos < len(words) && tokens[words[pos]].Is(keywords...) {
+			pos++
+
+			return true
+		}
+
+		return false
+	}
+
+	switch {
+	case skip("CREATE", "ATTACH"):
+		if skip("OR") {
+			skip("REPLACE")
+		}
+		if !skipObjectKind(skip) {
+			return 0, false
+		}
+		if skip("IF") {
+			skip("NOT")
+			skip("EXISTS")
+		}
+	case skip("ALTER"):
+		if !skip("TABLE") {
+			return 0, false
+		}
+	case skip("DROP", "DETACH"):
+		skip("TEMPORARY")
+		if !skipObjectKind(skip) {
+			return 0, false
+		}
+		if skip("IF") {
+			skip("EXISTS")
+		}
+	case skip("TRUNCATE"):
+		skip("TEMPORARY")
+		skip("TABLE")
+		if skip("IF") {
+			skip("EXISTS")
+		}
+	case skip("RENAME", "EXCHANGE"):
+		return len(tokens), true
+	default:
+		return 0, false
+	}
+
+	return nameEnd(tokens, words, pos)
+}
+
+func skipObjectKind(skip func(keywords ...string) bool) bool {
+	switch {
+	case skip("MATERIALIZED", "LIVE", "WINDOW"):
+		return skip("VIEW")
+	default:
+		return skip("TABLE", "VIEW", "DICTIONARY", "DATABASE", "FUNCTION")
+	}
+}
+
+func nameEnd(tokens []sqltoken.Token, words []int, pos int) (int, bool) {
+	if pos >= len(words) || !tokens[words[pos]].IsIdentifier() {
+		return 0, false
+	}
+
+	for pos+2 < len(words) && tokens[words[pos+1]].Text == "." && tokens[words[pos+2]].IsIdentifier() {
+		pos += 2
+	}
+
+	return words[pos] + 1, true
+}
+
+func waitDistributedDDL(ctx context.Context, conn driver.Conn, database string, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = defaultClusterDDLTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(clusterDDLPollInterval)
+	defer ticker.Stop()
+
+	for {
+		var status []distributedDDLStatus
+
+		err := conn.Select(
+			ctx, &status,
+			"SELECT count() AS pending FROM system.distributed_ddl_queue "+
+				"WHERE status != 'Finished' AND position(query, ?) > 0",
+			database,
+		)
+		if err != nil {
+			return fmt.Errorf("can't check distributed ddl queue: %w", err)
+		}
+
+		if len(status) == 0 || status[0].Pending == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %d tasks for database %s", ErrClusterDDLTimeout, status[0].Pending, database)
+		case <-ticker.C:
+		}
+	}
+}
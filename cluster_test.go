@@ -0,0 +1,112 @@
+package groclick
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const pendingDDLQuery = "SELECT count() AS pending FROM system.distributed_ddl_queue " +
+	"WHERE status != 'Finished' AND position(query, ?) > 0"
+
+func TestOnCluster(t *testing.T) {
+	cases := map[string]string{
+		"CREATE TABLE t (id UInt64) ENGINE = ReplicatedMergeTree('/ch/{shard}/t', '{replica}') ORDER BY id": "" +
+			"CREATE TABLE t ON CLUSTER 'main' (id UInt64) " +
+			"ENGINE = ReplicatedMergeTree('/ch/{shard}/t', '{replica}') ORDER BY id",
+		"CREATE OR REPLACE TABLE IF NOT EXISTS db.`t` AS other": "CREATE OR REPLACE TABLE IF NOT EXISTS db.`t` ON CLUSTER 'main' AS other",
+		"CREATE MATERIALIZED VIEW mv TO t AS SELECT 1":          "CREATE MATERIALIZED VIEW mv ON CLUSTER 'main' TO t AS SELECT 1",
+		"create dictionary d (id UInt64) PRIMARY KEY id":        "create dictionary d ON CLUSTER 'main' (id UInt64) PRIMARY KEY id",
+		"ALTER TABLE t ADD COLUMN x UInt8":                      "ALTER TABLE t ON CLUSTER 'main' ADD COLUMN x UInt8",
+		"DROP TABLE IF EXISTS t SYNC":                           "DROP TABLE IF EXISTS t ON CLUSTER 'main' SYNC",
+		"TRUNCATE t":                                            "TRUNCATE t ON CLUSTER 'main'",
+		"RENAME TABLE a TO b":                                   "RENAME TABLE a TO b ON CLUSTER 'main'",
+		"CREATE TABLE t ON CLUSTER other (id UInt8)":            "CREATE TABLE t ON CLUSTER other (id UInt8)",
+		"CREATE TEMPORARY TABLE t (id UInt8)":                   "CREATE TEMPORARY TABLE t (id UInt8)",
+		"CREATE LIVE TABLE t":                                   "CREATE LIVE TABLE t",
+		"ALTER USER u":                                          "ALTER USER u",
+		"CREATE TABLE (id UInt8)":                               "CREATE TABLE (id UInt8)",
+		"INSERT INTO t VALUES (1)":                              "INSERT INTO t VALUES (1)",
+	}
+
+	for statement, exp := range cases {
+		assert.Equal(t, exp, onCluster(statement, "main"), statement)
+	}
+
+	assert.Equal(t, "CREATE TABLE t", onCluster("CREATE TABLE t", ""))
+}
+
+func TestWaitDistributedDDL(t *testing.T) {
+	t.Run("should be able to wait until queue is drained", func(t *testing.T) {
+		conn := NewMockConn(t)
+		calls := atomic.Int32{}
+
+		conn.EXPECT().
+			Select(mock.Anything, mock.Anything, pendingDDLQuery, []any{"db"}).
+			RunAndReturn(func(ctx context.Context, dest any, query string, args ...any) error {
+				pending := uint64(0)
+				if calls.Add(1) == 1 {
+					pending = 1
+				}
+				*dest.(*[]distributedDDLStatus) = []distributedDDLStatus{{Pending: pending}}
+				return nil
+			})
+
+		require.NoError(t, waitDistributedDDL(t.Context(), conn, "db", 0))
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("should be able failed", func(t *testing.T) {
+		t.Run("when can't query queue", func(t *testing.T) {
+			conn := NewMockConn(t)
+			exp := errors.New(uuid.NewString())
+
+			conn.EXPECT().Select(mock.Anything, mock.Anything, pendingDDLQuery, []any{"db"}).Return(exp)
+
+			require.ErrorIs(t, waitDistributedDDL(t.Context(), conn, "db", time.Second), exp)
+		})
+
+		t.Run("when queue is not drained in time", func(t *testing.T) {
+			conn := NewMockConn(t)
+
+			conn.EXPECT().
+				Select(mock.Anything, mock.Anything, pendingDDLQuery, []any{"db"}).
+				RunAndReturn(func(ctx context.Context, dest any, query string, args ...any) error {
+					*dest.(*[]distributedDDLStatus) = []distributedDDLStatus{{Pending: 1}}
+					return nil
+				})
+
+			require.ErrorIs(t, waitDistributedDDL(t.Context(), conn, "db", time.Millisecond), ErrClusterDDLTimeout)
+		})
+	})
+}
+
+func TestForker_Cluster(t *testing.T) {
+	root := NewMockConn(t)
+	conn := NewMockConn(t)
+
+	fork := newIsolationForker(t.Context(), root, conn)
+	fork.cluster = "main"
+	fork.databases[0].Migrator = func(ctx context.Context, cfg MigratorConfig) error {
+		assert.Equal(t, "main", cfg.Cluster)
+		return nil
+	}
+
+	root.EXPECT().Exec(mock.Anything, "CREATE DATABASE `groclick_run_1` ON CLUSTER 'main'").Return(nil)
+	root.EXPECT().Exec(mock.Anything, "DROP DATABASE `groclick_run_1` ON CLUSTER 'main'").Return(nil)
+	root.EXPECT().
+		Select(mock.Anything, mock.Anything, pendingDDLQuery, []any{"groclick_run_1"}).
+		Return(nil)
+	conn.EXPECT().Ping(mock.Anything).Return(nil)
+
+	cfg := fork.fork(t, "", nil, nil).primary().cfg
+	require.NoError(t, fork.drop(t.Context(), cfg.Auth.Database))
+	assert.Equal(t, "groclick_run_1", cfg.Auth.Database)
+}
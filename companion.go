@@ -0,0 +1,213 @@
+package groclick
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/godepo/groat/pkg/generics"
+	"github.com/testcontainers/testcontainers-go"
+	tcexec "github.com/testcontainers/testcontainers-go/exec"
+	"github.com/testcontainers/testcontainers-go/network"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	ErrCompanionRequiresContainer = errors.New("companion containers require clickhouse container")
+	ErrCompanionExec              = errors.New("companion command failed")
+)
+
+type (
+	CompanionContainer interface {
+		PortEndpoint(ctx context.Context, port nat.Port, proto string) (string, error)
+		Exec(ctx context.Context, cmd []string, options ...tcexec.ProcessOption) (int, io.Reader, error)
+		Terminate(ctx context.Context, opts ...testcontainers.TerminateOption) error
+	}
+
+	companionRunner func(ctx context.Context, req testcontainers.GenericContainerRequest) (CompanionContainer, error)
+
+	companionNetwork func(
+		ctx context.Context,
+		labels map[string]string,
+	) (name string, remove func(ctx context.Context) error, err error)
+
+	// companions are containers started next to ClickHouse in shared network, they are terminated after it.
+	companions struct {
+		network    string
+		terminate  []func(ctx context.Context) error
+		s3         *minioCompanion
+		s3Label    string
+		kafka      *redpandaCompanion
+		kafkaLabel string
+	}
+)
+
+func defaultCompanionRunner(
+	ctx context.Context,
+	req testcontainers.GenericContainerRequest,
+) (CompanionContainer, error) {
+	return testcontainers.GenericContainer(ctx, req)
+}
+
+func defaultCompanionNetwork(
+	ctx context.Context,
+	labels map[string]string,
+) (string, func(ctx context.Context) error, error) {
+	nw, err := network.New(ctx, network.WithLabels(labels))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return nw.Name, nw.Remove, nil
+}
+
+func startCompanions(ctx context.Context, cfg config) (*companions, error) {
+	res := &companions{s3Label: cfg.injectLabelForS3, kafkaLabel: cfg.injectLabelForKafka}
+
+	if cfg.minioImage != "" {
+		s3, err := startMinIO(ctx, cfg, res)
+		if err != nil {
+			return res, err
+		}
+		res.s3 = s3
+	}
+
+	if cfg.redpandaImage != "" {
+		kafka, err := startRedpanda(ctx, cfg, res)
+		if err != nil {
+			return res, err
+		}
+		res.kafka = kafka
+	}
+
+	return res, nil
+}
+
+func (c *companions) run(
+	ctx context.Context,
+	cfg config,
+	alias string,
+	req testcontainers.GenericContainerRequest,
+) (CompanionContainer, error) {
+	if c.network == "" {
+		name, remove, err := cfg.companionNetwork(ctx, cfg.sessionLabels())
+		if err != nil {
+			return nil, fmt.Errorf("can't create companions network: %w", err)
+		}
+
+		c.network = name
+		c.terminate = append(c.terminate, remove)
+	}
+
+	if err := network.WithNetworkName([]string{alias}, c.network)(&req); err != nil {
+		return nil, fmt.Errorf("can't attach %s to companions network: %w", alias, err)
+	}
+	req.Started = true
+
+	if err := testcontainers.WithLabels(cfg.sessionLabels())(&req); err != nil {
+		return nil, fmt.Errorf("can't label %s companion: %w", alias, err)
+	}
+
+	spanCtx, span := cfg.tracer().Start(ctx, "groclick.companion.start", trace.WithAttributes(
+		attribute.String("companion", alias),
+		attribute.String("container.image", req.Image),
+	))
+
+	container, err := cfg.companionRunner(spanCtx, req)
+	endSpan(span, err)
+
+	if err != nil {
+		return nil, fmt.Errorf("can't run %s companion: %w", alias, err)
+	}
+
+	c.terminate = append(c.terminate, func(ctx context.Context) error {
+		return container.Terminate(ctx)
+	})
+
+	return container, nil
+}
+
+func (c *companions) customizers() []testcontainers.ContainerCustomizer {
+	if c.network == "" {
+		return nil
+	}
+
+	res := []testcontainers.ContainerCustomizer{network.WithNetworkName(nil, c.network)}
+	if c.s3 != nil {
+		res = append(res, c.s3.customizer())
+	}
+
+	return res
+}
+
+// terminateWith terminates ClickHouse container, then companions in reverse order of start.
+func (c *companions) terminateWith(
+	terminate func(ctx context.Context, opts ...testcontainers.TerminateOption) error,
+) func(ctx context.Context, opts ...testcontainers.TerminateOption) error {
+	return func(ctx context.Context, opts ...testcontainers.TerminateOption) error {
+		return errors.Join(terminate(ctx, opts...), c.shutdown(ctx))
+	}
+}
+
+func (c *companions) shutdown(ctx context.Context) error {
+	errs := make([]error, 0, len(c.terminate))
+
+	for i := len(c.terminate) - 1; i >= 0; i-- {
+		errs = append(errs, c.terminate[i](ctx))
+	}
+
+	c.terminate = nil
+
+	return errors.Join(errs...)
+}
+
+func injectCompanions[T any](t *testing.T, to T, c *companions, dbs forkedDatabases) T {
+	t.Helper()
+
+	if c == nil {
+		return to
+	}
+
+	if c.s3 != nil {
+		to = generics.Injector(t, c.s3.lease(t), to, c.s3Label)
+	}
+
+	if kafka := dbs.primary().kafka; kafka != nil {
+		to = generics.Injector(t, kafka, to, c.kafkaLabel)
+	}
+
+	return to
+}
+
+func execCompanion(ctx context.Context, container CompanionContainer, cmd ...string) error {
+	code, out, err := container.Exec(ctx, cmd, tcexec.Multiplexed())
+	if err != nil {
+		return fmt.Errorf("can't exec %s: %w", cmd[0], err)
+	}
+
+	if code != 0 {
+		var output []byte
+		if out != nil {
+			output, _ = io.ReadAll(out)
+		}
+
+		return fmt.Errorf("%w: %s exited with code %d: %s",
+			ErrCompanionExec, strings.Join(cmd, " "), code, bytes.TrimSpace(output))
+	}
+
+	return nil
+}
+
+func (c *companions) redpanda() *redpandaCompanion {
+	if c == nil {
+		return nil
+	}
+
+	return c.kafka
+}
@@ -0,0 +1,142 @@
+package groclick
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func companionConfig(
+	calls *[]string,
+	runner func(ctx context.Context, req testcontainers.GenericContainerRequest) (CompanionContainer, error),
+) config {
+	return config{
+		companionRunner: runner,
+		companionNetwork: func(
+			ctx context.Context,
+			labels map[string]string,
+		) (string, func(ctx context.Context) error, error) {
+			*calls = append(*calls, "network")
+
+			return "groclick-net", func(ctx context.Context) error {
+				*calls = append(*calls, "remove network")
+				return nil
+			}, nil
+		},
+	}
+}
+
+func TestCompanions(t *testing.T) {
+	t.Run("should be able to run companions in shared network", func(t *testing.T) {
+		var calls []string
+
+		requests := make([]testcontainers.GenericContainerRequest, 0, 2)
+		cfg := companionConfig(&calls, func(
+			ctx context.Context,
+			req testcontainers.GenericContainerRequest,
+		) (CompanionContainer, error) {
+			requests = append(requests, req)
+			alias := req.NetworkAliases["groclick-net"][0]
+
+			cont := NewMockCompanionContainer(t)
+			cont.EXPECT().Terminate(mock.Anything).RunAndReturn(
+				func(ctx context.Context, opts ...testcontainers.TerminateOption) error {
+					calls = append(calls, "terminate "+alias)
+					return nil
+				})
+
+			return cont, nil
+		})
+
+		comps := &companions{}
+
+		_, err := comps.run(t.Context(), cfg, "first", testcontainers.GenericContainerRequest{})
+		require.NoError(t, err)
+		_, err = comps.run(t.Context(), cfg, "second", testcontainers.GenericContainerRequest{})
+		require.NoError(t, err)
+
+		require.Len(t, requests, 2)
+		assert.True(t, requests[0].Started)
+		assert.Equal(t, []string{"groclick-net"}, requests[1].Networks)
+
+		req := testcontainers.GenericContainerRequest{}
+		for _, customizer := range comps.customizers() {
+			require.NoError(t, customizer.Customize(&req))
+		}
+		assert.Equal(t, []string{"groclick-net"}, req.Networks)
+
+		err = comps.terminateWith(func(ctx context.Context, opts ...testcontainers.TerminateOption) error {
+			calls = append(calls, "terminate clickhouse")
+			return nil
+		})(t.Context())
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{
+			"network", "terminate clickhouse", "terminate second", "terminate first", "remove network",
+		}, calls)
+	})
+
+	t.Run("should be able to skip network without companions", func(t *testing.T) {
+		assert.Empty(t, (&companions{}).customizers())
+	})
+
+	t.Run("should be able failed", func(t *testing.T) {
+		t.Run("when can't create network", func(t *testing.T) {
+			exp := errors.New(uuid.NewString())
+			cfg := config{companionNetwork: func(
+				ctx context.Context,
+				labels map[string]string,
+			) (string, func(ctx context.Context) error, error) {
+				return "", nil, exp
+			}}
+
+			_, err := (&companions{}).run(t.Context(), cfg, "first", testcontainers.GenericContainerRequest{})
+			require.ErrorIs(t, err, exp)
+		})
+
+		t.Run("when can't run companion", func(t *testing.T) {
+			var calls []string
+
+			exp := errors.New(uuid.NewString())
+			cfg := companionConfig(&calls, func(
+				ctx context.Context,
+				req testcontainers.GenericContainerRequest,
+			) (CompanionContainer, error) {
+				return nil, exp
+			})
+
+			comps := &companions{}
+			_, err := comps.run(t.Context(), cfg, "first", testcontainers.GenericContainerRequest{})
+			require.ErrorIs(t, err, exp)
+			require.NoError(t, comps.shutdown(t.Context()))
+			assert.Equal(t, []string{"network", "remove network"}, calls)
+		})
+	})
+}
+
+func TestExecCompanion(t *testing.T) {
+	t.Run("should be able to report exit code and output", func(t *testing.T) {
+		cont := NewMockCompanionContainer(t)
+		cont.EXPECT().Exec(mock.Anything, []string{"mc", "mb"}, mock.Anything).
+			Return(1, strings.NewReader("bucket exists\n"), nil)
+
+		err := execCompanion(t.Context(), cont, "mc", "mb")
+		require.ErrorIs(t, err, ErrCompanionExec)
+		assert.Contains(t, err.Error(), "mc mb exited with code 1: bucket exists")
+	})
+
+	t.Run("should be able failed when can't exec", func(t *testing.T) {
+		exp := errors.New(uuid.NewString())
+		cont := NewMockCompanionContainer(t)
+		cont.EXPECT().Exec(mock.Anything, []string{"mc"}, mock.Anything).Return(0, nil, exp)
+
+		require.ErrorIs(t, execCompanion(t.Context(), cont, "mc"), exp)
+	})
+}
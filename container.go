@@ -3,12 +3,11 @@ package groclick
 import (
 	"context"
 	"fmt"
-	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/godepo/groat/pkg/generics"
-	"github.com/stretchr/testify/require"
 )
 
 func newContainer[T any](
@@ -17,12 +16,8 @@ func newContainer[T any](
 	cfg config,
 ) (*Container[T], error) {
 	container := &Container[T]{
-		forks:           &atomic.Int32{},
-		click:           click,
-		ctx:             ctx,
-		migrator:        cfg.migrator,
-		migrationsPath:  cfg.migrationsPath,
-		connConstructor: cfg.connConstructor,
+		click: click,
+		ctx:   ctx,
 	}
 
 	connString, err := click.ConnectionString(ctx)
@@ -30,59 +25,94 @@ func newContainer[T any](
 		return nil, fmt.Errorf("can't get connection string: %w", err)
 	}
 
+	if cfg.containerTLS {
+		endpoints, ok := click.(containerEndpoints)
+		if !ok {
+			return nil, fmt.Errorf("%w port endpoints", ErrUnsupportedContainer)
+		}
+
+		endpoint, err := endpoints.PortEndpoint(ctx, containerTLSPort, "")
+		if err != nil {
+			return nil, fmt.Errorf("can't get secure endpoint: %w", err)
+		}
+
+		connString, err = secureConnString(connString, endpoint)
+		if err != nil {
+			return nil, err
+		}
+
+		if cfg.tlsServerName == "" {
+			cfg.tlsServerName = containerTLSServerName
+		}
+	}
+
+	tlsCfg, err := cfg.tlsConfig(cfg.containerCA)
+	if err != nil {
+		return nil, err
+	}
+
 	container.connString = connString
 	container.injectLabel = cfg.injectLabel
 	container.injectLabelForConfig = cfg.injectLabelForConfig
 	container.injectLabelForDSN = cfg.injectLabelForDSN
+	container.injectLabelForDBs = cfg.injectLabelForDBs
+	container.companions = cfg.companions
+	container.injectLabelForDicts = cfg.injectLabelForDicts
+	container.injectLabelForFuncs = cfg.injectLabelForFuncs
 
 	container.opts, err = clickhouse.ParseDSN(connString)
 	if err != nil {
 		return nil, fmt.Errorf("can't parse dsn: %w", err)
 	}
+	applyTLS(container.opts, tlsCfg)
+
+	connectedAt := time.Now()
+	connCtx, span := cfg.tracer().Start(ctx, "groclick.connect")
 
 	root, err := cfg.connConstructor(container.opts)
 	if err != nil {
+		endSpan(span, err)
+
 		return nil, fmt.Errorf("can't create connection to root db: %w", err)
 	}
 	container.root = root
 
+	err = waitReady(connCtx, root, cfg)
+	endSpan(span, err)
+	cfg.timings.since(PhaseConnect, connectedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fork := newForker(ctx, root, connString, "", cfg)
+	fork.tls = tlsCfg
+	container.fork = fork
+
+	container.isolation = newIsolator(cfg, fork, false)
+
 	return container, nil
 }
 
+// Injector forks databases for test, it is safe for parallel tests. Databases are created and migrated
+// within test context, so cancelled tests stop migrating, see WithMaxConcurrentForks.
 func (c *Container[T]) Injector(t *testing.T, to T) T {
 	t.Helper()
 
-	cfg, err := clickhouse.ParseDSN(c.connString)
-	require.NoError(t, err)
-
-	cfg.Auth.Database = fmt.Sprintf("%s_%d", cfg.Auth.Database, c.forks.Add(1))
-
-	err = c.root.Exec(
-		c.ctx,
-		"CREATE DATABASE "+cfg.Auth.Database,
-	)
-	require.NoError(t, err,
-		"can't created database=%s for user %s",
-		cfg.Auth.Database, cfg.Auth.Username,
-	)
-
-	con, err := clickhouse.Open(cfg)
-	require.NoError(t, err)
-
-	require.NoError(t, con.Ping(c.ctx))
-
-	err = c.migrator(c.ctx, MigratorConfig{
-		Config:   cfg,
-		DB:       con,
-		DBName:   cfg.Auth.Database,
-		Path:     c.migrationsPath,
-		UserName: cfg.Auth.Username,
-		Password: cfg.Auth.Password,
-	})
-	require.NoError(t, err)
-	res := generics.Injector(t, &Connect{con}, to, c.injectLabel)
-	res = generics.Injector(t, cfg, res, c.injectLabelForConfig)
+	if c.logs != nil {
+		c.logs.attach(t)
+	}
+
+	dbs := c.isolation.lease(t)
+	db := dbs.primary()
+
+	res := generics.Injector(t, &Connect{db.conn}, to, c.injectLabel)
+	res = generics.Injector(t, db.cfg, res, c.injectLabelForConfig)
 	res = generics.Injector(t, c.connString, res, c.injectLabelForDSN)
+	res = injectDatabases(t, res, dbs, c.injectLabel, c.injectLabelForDBs)
+	res = injectCompanions(t, res, c.companions, dbs)
+	res = injectDictionaries(t, res, dbs, c.fork, c.injectLabelForDicts)
+	res = generics.Injector(t, c.fork.functionsOf(dbs), res, c.injectLabelForFuncs)
 
 	return res
 }
@@ -0,0 +1,203 @@
+package groclick
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+)
+
+const (
+	LogLevelNone LogLevel = iota
+	LogLevelTrace
+	LogLevelDebug
+	LogLevelInformation
+	LogLevelWarning
+	LogLevelError
+	LogLevelFatal
+)
+
+const (
+	containerLoggerConfigPath = "/etc/clickhouse-server/config.d/groclick-logger.xml"
+	containerLogsLimit        = 10000
+	containerLogsFlushDelay   = 200 * time.Millisecond
+)
+
+var ErrInvalidLogLevel = errors.New("invalid log level")
+
+var logLevelNames = map[LogLevel]string{
+	LogLevelNone:        "none",
+	LogLevelTrace:       "trace",
+	LogLevelDebug:       "debug",
+	LogLevelInformation: "information",
+	LogLevelWarning:     "warning",
+	LogLevelError:       "error",
+	LogLevelFatal:       "fatal",
+}
+
+type (
+	LogLevel int
+
+	containerLogLine struct {
+		at    time.Time
+		level LogLevel
+		text  string
+	}
+
+	// containerLogs follows container output and keeps recent lines to report them for failed tests.
+	containerLogs struct {
+		mu         sync.Mutex
+		level      LogLevel
+		limit      int
+		lines      []containerLogLine
+		last       LogLevel
+		now        func() time.Time
+		flushDelay time.Duration
+	}
+)
+
+// WithContainerLogs follows clickhouse server output and prints lines with level not lower than given
+// one, logged while test was running, into output of failed tests.
+func WithContainerLogs(level LogLevel) Option {
+	return func(c *config) {
+		c.containerLogs = level
+	}
+}
+
+func (l LogLevel) String() string {
+	if name, ok := logLevelNames[l]; ok {
+		return name
+	}
+
+	return strconv.Itoa(int(l))
+}
+
+func ParseLogLevel(value string) (LogLevel, error) {
+	for level, name := range logLevelNames {
+		if strings.EqualFold(name, value) {
+			return level, nil
+		}
+	}
+
+	return LogLevelNone, fmt.Errorf("%w: %s", ErrInvalidLogLevel, value)
+}
+
+func newContainerLogs(level LogLevel) *containerLogs {
+	return &containerLogs{
+		level:      level,
+		limit:      containerLogsLimit,
+		last:       LogLevelInformation,
+		now:        time.Now,
+		flushDelay: containerLogsFlushDelay,
+	}
+}
+
+func (c *containerLogs) Accept(log testcontainers.Log) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	at := c.now()
+
+	for _, text := range strings.Split(strings.TrimRight(string(log.Content), "\n"), "\n") {
+		level, ok := parseServerLogLevel(text)
+		if ok {
+			c.last = level
+		} else {
+			level = c.last
+		}
+
+		if level < c.level {
+			continue
+		}
+
+		if len(c.lines) == c.limit {
+			c.lines = c.lines[1:]
+		}
+		c.lines = append(c.lines, containerLogLine{at: at, level: level, text: text})
+	}
+}
+
+func (c *containerLogs) attach(t *testing.T) {
+	t.Helper()
+
+	started := c.now()
+
+	t.Cleanup(func() {
+		if !t.Failed() {
+			return
+		}
+
+		time.Sleep(c.flushDelay)
+
+		lines := c.between(started, c.now())
+		if len(lines) == 0 {
+			return
+		}
+
+		t.Logf("---[GOAT]: clickhouse server logs:\n%s", strings.Join(lines, "\n"))
+	})
+}
+
+func (c *containerLogs) between(from, to time.Time) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := make([]string, 0)
+
+	for _, line := range c.lines {
+		if line.at.Before(from) || line.at.After(to) {
+			continue
+		}
+		res = append(res, line.text)
+	}
+
+	return res
+}
+
+func (c *containerLogs) customizer() testcontainers.CustomizeRequestOption {
+	return func(req *testcontainers.GenericContainerRequest) error {
+		req.Files = append(req.Files, testcontainers.ContainerFile{
+			Reader:            bytes.NewBufferString(containerLoggerConfig(c.level)),
+			ContainerFilePath: containerLoggerConfigPath,
+			FileMode:          certFileMode,
+		})
+
+		return testcontainers.WithLogConsumers(c)(req)
+	}
+}
+
+// containerLoggerConfig duplicates server log, including clickhouse-server.err.log records, to console.
+func containerLoggerConfig(level LogLevel) string {
+	return `<clickhouse>
+    <logger>
+        <level>` + level.String() + `</level>
+        <console>1</console>
+    </logger>
+</clickhouse>
+`
+}
+
+func parseServerLogLevel(line string) (LogLevel, bool) {
+	start := strings.IndexByte(line, '<')
+	if start < 0 {
+		return LogLevelNone, false
+	}
+
+	end := strings.IndexByte(line[start:], '>')
+	if end < 0 {
+		return LogLevelNone, false
+	}
+
+	level, err := ParseLogLevel(line[start+1 : start+end])
+	if err != nil || level == LogLevelNone {
+		return LogLevelNone, false
+	}
+
+	return level, true
+}
@@ -0,0 +1,73 @@
+package groclick
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestContainerLogs(t *testing.T) {
+	t.Run("should be able to filter lines by level", func(t *testing.T) {
+		logs := newContainerLogs(LogLevelWarning)
+
+		logs.Accept(testcontainers.Log{Content: []byte(
+			"2025.01.01 10:00:00.000000 [ 1 ] {} <Information> Application: Ready\n" +
+				"2025.01.01 10:00:01.000000 [ 2 ] {q1} <Error> executeQuery: Code: 60. DB::Exception\n" +
+				"0. DB::Exception::Exception()\n",
+		)})
+		logs.Accept(testcontainers.Log{Content: []byte("2025.01.01 10:00:02.000000 [ 2 ] {q2} <Debug> x\n")})
+
+		lines := logs.between(time.Now().Add(-time.Minute), time.Now())
+		assert.Equal(t, []string{
+			"2025.01.01 10:00:01.000000 [ 2 ] {q1} <Error> executeQuery: Code: 60. DB::Exception",
+			"0. DB::Exception::Exception()",
+		}, lines)
+	})
+
+	t.Run("should be able to keep lines of test time window", func(t *testing.T) {
+		logs := newContainerLogs(LogLevelTrace)
+		now := time.Now()
+
+		logs.now = func() time.Time { return now.Add(-time.Hour) }
+		logs.Accept(testcontainers.Log{Content: []byte("<Error> before")})
+		logs.now = func() time.Time { return now }
+		logs.Accept(testcontainers.Log{Content: []byte("<Error> during")})
+
+		assert.Equal(t, []string{"<Error> during"}, logs.between(now.Add(-time.Minute), now))
+	})
+
+	t.Run("should be able to limit buffered lines", func(t *testing.T) {
+		logs := newContainerLogs(LogLevelTrace)
+		logs.limit = 2
+
+		logs.Accept(testcontainers.Log{Content: []byte("<Error> one\n<Error> two\n<Error> three\n")})
+
+		assert.Equal(t, []string{"<Error> two", "<Error> three"}, logs.between(time.Time{}, time.Now()))
+	})
+
+	t.Run("should be able to customize container", func(t *testing.T) {
+		req := testcontainers.GenericContainerRequest{}
+
+		require.NoError(t, newContainerLogs(LogLevelError).customizer()(&req))
+		require.NotNil(t, req.LogConsumerCfg)
+		assert.Len(t, req.LogConsumerCfg.Consumers, 1)
+		require.Len(t, req.Files, 1)
+		assert.Equal(t, containerLoggerConfigPath, req.Files[0].ContainerFilePath)
+		assert.Contains(t, containerLoggerConfig(LogLevelError), "<level>error</level>")
+	})
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for level := range logLevelNames {
+		res, err := ParseLogLevel(level.String())
+		require.NoError(t, err)
+		assert.Equal(t, level, res)
+	}
+
+	_, err := ParseLogLevel(uuid.NewString())
+	require.ErrorIs(t, err, ErrInvalidLogLevel)
+}
@@ -0,0 +1,142 @@
+package groclick
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/godepo/groat/pkg/generics"
+)
+
+var ErrInvalidLogicalDatabase = errors.New("invalid logical database")
+
+type (
+	// LogicalDatabase is database created for every test next to its siblings. Name is database name used in
+	// migrations, references to sibling databases are rewritten to physical names of the test. PlainMigrator
+	// with MigrationsPath is used when Migrator is nil.
+	LogicalDatabase struct {
+		Name           string
+		MigrationsPath string
+		Migrator       Migrator
+	}
+
+	forkedDatabase struct {
+		name  string
+		cfg   *clickhouse.Options
+		conn  driver.Conn
+		kafka *Kafka
+	}
+
+	forkedDatabases []forkedDatabase
+)
+
+// WithDatabases declares logical databases created for every test instead of single one. Databases are
+// migrated in declared order, first of them is injected by inject label, each one is injected by
+// "<inject label>.<name>" and "<inject label>.<name>.config" labels, all of them as map[string]*Connect.
+func WithDatabases(databases ...LogicalDatabase) Option {
+	return func(c *config) {
+		c.databases = databases
+	}
+}
+
+func WithInjectLabelForDatabases(label string) Option {
+	return func(c *config) {
+		c.injectLabelForDBs = label
+	}
+}
+
+func (c config) logicalDatabases() []LogicalDatabase {
+	if len(c.databases) > 0 {
+		return c.databases
+	}
+
+	return []LogicalDatabase{{Migrator: c.migrator, MigrationsPath: c.migrationsPath}}
+}
+
+func prepareMigrators(cfg *config) error {
+	if len(cfg.databases) == 0 {
+		if cfg.migrator != nil {
+			return nil
+		}
+
+		if err := lintAtBootstrap(*cfg, cfg.migrationsPath); err != nil {
+			return err
+		}
+
+		if err := discoverFunctions(cfg, cfg.migrationsPath); err != nil {
+			return err
+		}
+
+		mig, err := PlainMigrator(cfg.fs, cfg.migrationsPath)
+		if err != nil {
+			return err
+		}
+		cfg.migrator = mig
+
+		return nil
+	}
+
+	databases := slices.Clone(cfg.databases)
+	seen := make(map[string]bool, len(databases))
+
+	for i, db := range databases {
+		if db.Name == "" || seen[db.Name] {
+			return fmt.Errorf("%w: name %q is empty or duplicated", ErrInvalidLogicalDatabase, db.Name)
+		}
+		seen[db.Name] = true
+
+		if db.Migrator != nil {
+			continue
+		}
+
+		if err := lintAtBootstrap(*cfg, db.MigrationsPath); err != nil {
+			return fmt.Errorf("can't lint migrations of database %s: %w", db.Name, err)
+		}
+
+		if err := discoverFunctions(cfg, db.MigrationsPath); err != nil {
+			return fmt.Errorf("can't read functions of database %s: %w", db.Name, err)
+		}
+
+		mig, err := PlainMigrator(cfg.fs, db.MigrationsPath)
+		if err != nil {
+			return fmt.Errorf("can't read migrations of database %s: %w", db.Name, err)
+		}
+		databases[i].Migrator = mig
+	}
+
+	cfg.databases = databases
+
+	return nil
+}
+
+func (dbs forkedDatabases) primary() forkedDatabase {
+	return dbs[0]
+}
+
+func (dbs forkedDatabases) connects() map[string]*Connect {
+	res := make(map[string]*Connect, len(dbs))
+	for _, db := range dbs {
+		res[db.name] = &Connect{db.conn}
+	}
+
+	return res
+}
+
+func injectDatabases[T any](t *testing.T, to T, dbs forkedDatabases, label, labelForDatabases string) T {
+	t.Helper()
+
+	if dbs.primary().name == "" {
+		return to
+	}
+
+	res := generics.Injector(t, dbs.connects(), to, labelForDatabases)
+	for _, db := range dbs {
+		res = generics.Injector(t, &Connect{db.conn}, res, label+"."+db.name)
+		res = generics.Injector(t, db.cfg, res, label+"."+db.name+".config")
+	}
+
+	return res
+}
@@ -0,0 +1,113 @@
+package groclick
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type logicalDeps struct {
+	Primary   *Connect            `groat:"clickhouse"`
+	Raw       *Connect            `groat:"clickhouse.raw"`
+	Agg       *Connect            `groat:"clickhouse.agg"`
+	AggConfig *clickhouse.Options `groat:"clickhouse.agg.config"`
+	Databases map[string]*Connect `groat:"clickhouse.databases"`
+}
+
+func TestForker_LogicalDatabases(t *testing.T) {
+	root := NewMockConn(t)
+	raw := NewMockConn(t)
+	agg := NewMockConn(t)
+	migrated := make([]string, 0, 2)
+	exp := map[string]string{"raw": "groclick_raw_run_1", "agg": "groclick_agg_run_2"}
+
+	migrator := func(ctx context.Context, cfg MigratorConfig) error {
+		migrated = append(migrated, cfg.Path)
+		assert.Equal(t, exp, cfg.Databases)
+		return nil
+	}
+
+	fork := newForker(t.Context(), root, isolationDSN, "", config{
+		runID: "run",
+		databases: []LogicalDatabase{
+			{Name: "raw", MigrationsPath: "/raw", Migrator: migrator},
+			{Name: "agg", MigrationsPath: "/agg", Migrator: migrator},
+		},
+		connConstructor: func(opt *clickhouse.Options) (driver.Conn, error) {
+			if opt.Auth.Database == exp["raw"] {
+				return raw, nil
+			}
+			return agg, nil
+		},
+	})
+
+	root.EXPECT().Exec(mock.Anything, "CREATE DATABASE `groclick_raw_run_1`").Return(nil).Once()
+	root.EXPECT().Exec(mock.Anything, "CREATE DATABASE `groclick_agg_run_2`").Return(nil).Once()
+	raw.EXPECT().Ping(mock.Anything).Return(nil)
+	agg.EXPECT().Ping(mock.Anything).Return(nil)
+
+	dbs := fork.fork(t, "", nil, nil)
+
+	require.Len(t, dbs, 2)
+	assert.Equal(t, []string{"/raw", "/agg"}, migrated)
+	assert.Equal(t, "raw", dbs.primary().name)
+
+	t.Run("should be able to inject databases by labels", func(t *testing.T) {
+		res := injectDatabases(t, logicalDeps{Primary: &Connect{raw}}, dbs, "clickhouse", "clickhouse.databases")
+
+		assert.Same(t, raw, res.Primary.Conn)
+		assert.Same(t, raw, res.Raw.Conn)
+		assert.Same(t, agg, res.Agg.Conn)
+		assert.Equal(t, "groclick_agg_run_2", res.AggConfig.Auth.Database)
+		require.Len(t, res.Databases, 2)
+		assert.Same(t, agg, res.Databases["agg"].Conn)
+	})
+
+	t.Run("should be able to skip injection of default database", func(t *testing.T) {
+		res := injectDatabases(t, logicalDeps{}, forkedDatabases{{conn: raw}}, "clickhouse", "clickhouse.databases")
+
+		assert.Nil(t, res.Databases)
+	})
+}
+
+func TestPrepareMigrators(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/raw/001.sql", []byte("CREATE TABLE IF NOT EXISTS events "+
+		"(id UInt64) ENGINE = MergeTree ORDER BY id"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/agg/001.sql", []byte("CREATE MATERIALIZED VIEW IF NOT EXISTS mv "+
+		"TO agg.totals AS SELECT count() AS total FROM raw.events"), 0o644))
+
+	t.Run("should be able to build plain migrators", func(t *testing.T) {
+		cfg := config{fs: fs, lint: &LintConfig{}, databases: []LogicalDatabase{
+			{Name: "raw", MigrationsPath: "/raw"},
+			{Name: "agg", MigrationsPath: "/agg"},
+		}}
+
+		require.NoError(t, prepareMigrators(&cfg))
+		assert.NotNil(t, cfg.databases[0].Migrator)
+		assert.NotNil(t, cfg.databases[1].Migrator)
+	})
+
+	t.Run("should be able failed", func(t *testing.T) {
+		t.Run("when name is duplicated", func(t *testing.T) {
+			cfg := config{fs: fs, databases: []LogicalDatabase{
+				{Name: "raw", MigrationsPath: "/raw"},
+				{Name: "raw", MigrationsPath: "/agg"},
+			}}
+
+			require.ErrorIs(t, prepareMigrators(&cfg), ErrInvalidLogicalDatabase)
+		})
+
+		t.Run("when migrations dir not exists", func(t *testing.T) {
+			cfg := config{fs: fs, databases: []LogicalDatabase{{Name: "dict", MigrationsPath: "/dict"}}}
+
+			require.ErrorContains(t, prepareMigrators(&cfg), "can't read migrations of database dict")
+		})
+	})
+}
@@ -0,0 +1,460 @@
+package groclick
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/docker/docker/api/types/container"
+	"github.com/godepo/groat/pkg/generics"
+	"github.com/godepo/groclick/internal/pkg/sqltoken"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+const (
+	StandInNone DictionaryStandIn = iota
+	StandInTable
+	StandInHTTP
+)
+
+const (
+	defaultDictionaryStubHost = "host.docker.internal"
+	loopbackAddress           = "127.0.0.1"
+	dictionaryTableSuffix     = "_source"
+	dictionaryStubReadTimeout = 10 * time.Second
+)
+
+var (
+	ErrDictionaryStubDisabled     = errors.New("dictionary http stand-in is not configured")
+	ErrDictionaryStubHostRequired = errors.New("dictionary http stand-in with hosted server requires stub host")
+)
+
+var dictionaryColumnModifiers = []string{"DEFAULT", "EXPRESSION", "HIERARCHICAL", "INJECTIVE", "IS_OBJECT_ID"}
+
+type (
+	// DictionaryStandIn replaces SOURCE clause of dictionary created by migrations. StandInTable reads
+	// dictionary from "<dictionary>_source" table created in test database, StandInHTTP reads JSONEachRow
+	// rows served by test process.
+	DictionaryStandIn int
+
+	// DictionaryStandIns rewrites dictionaries of Database, ByName overrides Default, which is applied only
+	// to dictionaries with sources other than ClickHouse. URL is base URL of HTTP stand-in.
+	DictionaryStandIns struct {
+		ByName   map[string]DictionaryStandIn
+		Default  DictionaryStandIn
+		Database string
+		URL      string
+	}
+
+	// Dictionaries seeds stand-ins of dictionaries from test database and reloads them.
+	Dictionaries struct {
+		conn     driver.Conn
+		database string
+		cluster  string
+		stub     *dictionaryStub
+	}
+
+	dictionaryStub struct {
+		server *http.Server
+		url    string
+		mu     sync.RWMutex
+		rows   map[string][]byte
+	}
+)
+
+// WithDictionaryStandIn replaces sources of listed dictionaries or, without names, of all dictionaries
+// which don't read from ClickHouse.
+func WithDictionaryStandIn(standIn DictionaryStandIn, dictionaries ...string) Option {
+	return func(c *config) {
+		if c.dictionaryStandIns == nil {
+			c.dictionaryStandIns = make(map[string]DictionaryStandIn)
+		}
+
+		if len(dictionaries) == 0 {
+			c.dictionaryStandIns[""] = standIn
+		}
+
+		for _, name := range dictionaries {
+			c.dictionaryStandIns[name] = standIn
+		}
+	}
+}
+
+// WithDictionaryStubHost sets host of test process reachable from ClickHouse server. Container reaches
+// host.docker.internal by default, hosted server requires host set explicitly.
+func WithDictionaryStubHost(host string) Option {
+	return func(c *config) {
+		c.dictionaryStubHost = host
+	}
+}
+
+func WithInjectLabelForDictionaries(label string) Option {
+	return func(c *config) {
+		c.injectLabelForDicts = label
+	}
+}
+
+// Rewrite returns statements replacing given one, table stand-in is created before dictionary.
+func (s DictionaryStandIns) Rewrite(statement string) []string {
+	if len(s.ByName) == 0 && s.Default == StandInNone {
+		return []string{statement}
+	}
+
+	tokens := sqltoken.Tokenize(statement)
+	words := sqltoken.Significant(tokens)
+	word := func(i int) sqltoken.Token {
+		if i < 0 || i >= len(words) {
+			return sqltoken.Token{}
+		}
+
+		return tokens[words[i]]
+	}
+
+	name, columns, ok := dictionaryDefinition(word)
+	if !ok {
+		return []string{statement}
+	}
+
+	source, end := -1, -1
+	for i := columns; i+1 < len(words) && source < 0; i++ {
+		if word(i).Is("SOURCE") && word(i+1).Text == "(" {
+			source, end = i+1, closingParen(word, i+1)
+		}
+	}
+
+	if source < 0 || end < 0 {
+		return []string{statement}
+	}
+
+	standIn, ok := s.ByName[name]
+	if !ok {
+		if word(source + 1).Is("CLICKHOUSE") {
+			return []string{statement}
+		}
+
+		standIn = s.Default
+	}
+
+	var (
+		replacement string
+		res         []string
+	)
+
+	switch standIn {
+	case StandInTable:
+		table := quoteIdentifier(s.Database) + "." + quoteIdentifier(name+dictionaryTableSuffix)
+		res = append(res, "CREATE TABLE IF NOT EXISTS "+table+" ("+
+			dictionaryColumns(tokens, words, columns)+") ENGINE = Memory")
+		replacement = "CLICKHOUSE(DB " + quoteString(s.Database) +
+			" TABLE " + quoteString(name+dictionaryTableSuffix) + ")"
+	case StandInHTTP:
+		replacement = "HTTP(URL " + quoteString(s.URL+"/"+name) + " FORMAT 'JSONEachRow')"
+	default:
+		return []string{statement}
+	}
+
+	rewritten := sqltoken.Join(tokens[:words[source]+1]) + replacement + sqltoken.Join(tokens[words[end]:])
+
+	return append(res, rewritten)
+}
+
+// Table returns qualified name of table stand-in of dictionary.
+func (d *Dictionaries) Table(dictionary string) string {
+	return quoteIdentifier(d.database) + "." + quoteIdentifier(dictionary+dictionaryTableSuffix)
+}
+
+// Serve sets rows, encoded as JSON objects, returned by HTTP stand-in of dictionary.
+func (d *Dictionaries) Serve(dictionary string, rows ...any) error {
+	if d.stub == nil {
+		return ErrDictionaryStubDisabled
+	}
+
+	var buf bytes.Buffer
+
+	enc := json.NewEncoder(&buf)
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return fmt.Errorf("can't encode dictionary row: %w", err)
+		}
+	}
+
+	d.stub.serve(d.database, dictionary, buf.Bytes())
+
+	return nil
+}
+
+// Reload reloads listed dictionaries of test database or all of them without names.
+func (d *Dictionaries) Reload(ctx context.Context, dictionaries ...string) error {
+	if len(dictionaries) == 0 {
+		return reloadDictionaries(ctx, d.conn, d.database, d.cluster)
+	}
+
+	for _, name := range dictionaries {
+		if err := reloadDictionary(ctx, d.conn, d.database, name, d.cluster); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c config) usesDictionaryStub() bool {
+	for _, standIn := range c.dictionaryStandIns {
+		if standIn == StandInHTTP {
+			return true
+		}
+	}
+
+	return false
+}
+
+// startContainerDictionaryStub listens on docker bridge gateway, which host-gateway resolves to, and falls back
+// to loopback when gateway isn't local address, like with docker desktop.
+func startContainerDictionaryStub(
+	ctx context.Context,
+	gateway func(ctx context.Context) (string, error),
+	host string,
+) (*dictionaryStub, error) {
+	if gateway != nil {
+		if addr, err := gateway(ctx); err == nil {
+			if stub, err := startDictionaryStub(ctx, addr, host); err == nil {
+				return stub, nil
+			}
+		}
+	}
+
+	return startDictionaryStub(ctx, loopbackAddress, host)
+}
+
+func dockerGatewayIP(ctx context.Context) (string, error) {
+	provider, err := testcontainers.NewDockerProvider()
+	if err != nil {
+		return "", fmt.Errorf("can't create docker provider: %w", err)
+	}
+
+	defer func() {
+		_ = provider.Close()
+	}()
+
+	gateway, err := provider.GetGatewayIP(ctx)
+	if err != nil {
+		return "", fmt.Errorf("can't get docker gateway: %w", err)
+	}
+
+	return gateway, nil
+}
+
+func startDictionaryStub(ctx context.Context, listen, host string) (*dictionaryStub, error) {
+	listener, err := (&net.ListenConfig{}).Listen(ctx, "tcp", net.JoinHostPort(listen, "0"))
+	if err != nil {
+		return nil, fmt.Errorf("can't listen dictionary stub: %w", err)
+	}
+
+	stub := &dictionaryStub{
+		url:  "http://" + net.JoinHostPort(host, strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)),
+		rows: make(map[string][]byte),
+	}
+	stub.server = &http.Server{Handler: stub, ReadHeaderTimeout: dictionaryStubReadTimeout}
+
+	go func() {
+		_ = stub.server.Serve(listener)
+	}()
+
+	context.AfterFunc(ctx, func() {
+		_ = stub.server.Close()
+	})
+
+	return stub, nil
+}
+
+func (s *dictionaryStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	rows := s.rows[r.URL.Path]
+	s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	_, _ = w.Write(rows)
+}
+
+func (s *dictionaryStub) serve(database, dictionary string, rows []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rows["/"+database+"/"+dictionary] = rows
+}
+
+func (s *dictionaryStub) standIns(standIns map[string]DictionaryStandIn, database string) DictionaryStandIns {
+	res := DictionaryStandIns{ByName: make(map[string]DictionaryStandIn, len(standIns)), Database: database}
+
+	for name, standIn := range standIns {
+		if name == "" {
+			res.Default = standIn
+
+			continue
+		}
+
+		res.ByName[name] = standIn
+	}
+
+	if s != nil {
+		res.URL = s.url + "/" + database
+	}
+
+	return res
+}
+
+// hostGateway resolves stub host to docker host from ClickHouse container.
+func hostGateway(host string) testcontainers.CustomizeRequestOption {
+	return func(req *testcontainers.GenericContainerRequest) error {
+		modifier := req.HostConfigModifier
+
+		req.HostConfigModifier = func(hostConfig *container.HostConfig) {
+			if modifier != nil {
+				modifier(hostConfig)
+			}
+
+			hostConfig.ExtraHosts = append(hostConfig.ExtraHosts, host+":host-gateway")
+		}
+
+		return nil
+	}
+}
+
+func injectDictionaries[T any](t *testing.T, to T, dbs forkedDatabases, f *forker, label string) T {
+	t.Helper()
+
+	db := dbs.primary()
+
+	return generics.Injector(t, &Dictionaries{
+		conn:     db.conn,
+		database: db.cfg.Auth.Database,
+		cluster:  f.cluster,
+		stub:     f.stub,
+	}, to, label)
+}
+
+// dictionaryDefinition returns name of created dictionary and position of its columns list opening paren.
+func dictionaryDefinition(word func(i int) sqltoken.Token) (string, int, bool) {
+	pos := 0
+	skip := func(keywords ...string) bool {
+		if word(pos).Is(keywords...) {
+			pos++
+
+			return true
+		}
+
+		return false
+	}
+
+	if !skip("CREATE") {
+		return "", 0, false
+	}
+
+	if skip("OR") && !skip("REPLACE") {
+		return "", 0, false
+	}
+
+	if !skip("DICTIONARY") {
+		return "", 0, false
+	}
+
+	if skip("IF") && !(skip("NOT") && skip("EXISTS")) {
+		return "", 0, false
+	}
+
+	if !word(pos).IsIdentifier() {
+		return "", 0, false
+	}
+
+	name := word(pos).Value()
+	if word(pos+1).Text == "." && word(pos+2).IsIdentifier() {
+		pos += 2
+		name = word(pos).Value()
+	}
+	pos++
+
+	for word(pos).Is("ON") && word(pos+1).Is("CLUSTER") {
+		pos += 3
+	}
+
+	if word(pos).Text != "(" {
+		return "", 0, false
+	}
+
+	return name, pos, true
+}
+
+func closingParen(word func(i int) sqltoken.Token, open int) int {
+	depth := 0
+
+	for i := open; word(i).Text != ""; i++ {
+		switch word(i).Text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// dictionaryColumns converts dictionary attributes to table columns, dropping attribute modifiers.
+func dictionaryColumns(tokens []sqltoken.Token, words []int, open int) string {
+	columns := make([]string, 0)
+	depth := 0
+	start := open + 1
+	skip := false
+
+	var column strings.Builder
+
+	for i := start; i < len(words); i++ {
+		token := tokens[words[i]]
+
+		switch {
+		case token.Text == "(":
+			depth++
+		case token.Text == ")" && depth == 0, token.Text == "," && depth == 0:
+			columns = append(columns, strings.TrimSpace(column.String()))
+			column.Reset()
+			skip = false
+
+			if token.Text == ")" {
+				return strings.Join(columns, ", ")
+			}
+
+			continue
+		case token.Text == ")":
+			depth--
+		case depth == 0 && token.Is(dictionaryColumnModifiers...):
+			skip = true
+		}
+
+		if !skip {
+			column.WriteString(sqltoken.Join(tokens[words[i]:nextWord(words, i, len(tokens))]))
+		}
+	}
+
+	return strings.Join(columns, ", ")
+}
+
+func nextWord(words []int, i, end int) int {
+	if i+1 < len(words) {
+		return words[i+1]
+	}
+
+	return end
+}
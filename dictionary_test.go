@@ -0,0 +1,153 @@
+package groclick
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestDictionaryStandIns_Rewrite(t *testing.T) {
+	standIns := DictionaryStandIns{
+		ByName:   map[string]DictionaryStandIn{"countries": StandInTable},
+		Default:  StandInHTTP,
+		Database: "groclick_run_1",
+		URL:      "http://host.docker.internal:8080/groclick_run_1",
+	}
+
+	cases := map[string][]string{
+		"CREATE DICTIONARY IF NOT EXISTS users (id UInt64, name String DEFAULT '') PRIMARY KEY id " +
+			"SOURCE(POSTGRESQL(host 'pg' port 5432 table 'users')) LAYOUT(HASHED()) LIFETIME(300)": {
+			"CREATE DICTIONARY IF NOT EXISTS users (id UInt64, name String DEFAULT '') PRIMARY KEY id " +
+				"SOURCE(HTTP(URL 'http://host.docker.internal:8080/groclick_run_1/users' FORMAT 'JSONEachRow')) " +
+				"LAYOUT(HASHED()) LIFETIME(300)",
+		},
+		"CREATE OR REPLACE DICTIONARY `groclick_run_1`.countries (\n  code String,\n  name Nullable(String) " +
+			"DEFAULT NULL INJECTIVE\n) PRIMARY KEY code SOURCE(CLICKHOUSE(TABLE 'src')) LAYOUT(COMPLEX_KEY_HASHED())": {
+			"CREATE TABLE IF NOT EXISTS `groclick_run_1`.`countries_source` (code String, name Nullable(String)) " +
+				"ENGINE = Memory",
+			"CREATE OR REPLACE DICTIONARY `groclick_run_1`.countries (\n  code String,\n  name Nullable(String) " +
+				"DEFAULT NULL INJECTIVE\n) PRIMARY KEY code SOURCE(CLICKHOUSE(DB 'groclick_run_1' TABLE " +
+				"'countries_source')) LAYOUT(COMPLEX_KEY_HASHED())",
+		},
+		"CREATE DICTIONARY local (id UInt64) PRIMARY KEY id SOURCE(CLICKHOUSE(TABLE 'src')) LAYOUT(FLAT())": {
+			"CREATE DICTIONARY local (id UInt64) PRIMARY KEY id SOURCE(CLICKHOUSE(TABLE 'src')) LAYOUT(FLAT())",
+		},
+		"CREATE TABLE users (id UInt64) ENGINE = Memory": {
+			"CREATE TABLE users (id UInt64) ENGINE = Memory",
+		},
+	}
+
+	for statement, exp := range cases {
+		assert.Equal(t, exp, standIns.Rewrite(statement), statement)
+	}
+
+	assert.Equal(t, []string{"CREATE DICTIONARY d (id UInt64) SOURCE(MYSQL())"},
+		DictionaryStandIns{}.Rewrite("CREATE DICTIONARY d (id UInt64) SOURCE(MYSQL())"))
+}
+
+func TestDictionaries(t *testing.T) {
+	t.Run("should be able to serve rows by stub", func(t *testing.T) {
+		stub, err := startDictionaryStub(t.Context(), loopbackAddress, loopbackAddress)
+		require.NoError(t, err)
+
+		dicts := &Dictionaries{database: "db", stub: stub}
+		require.NoError(t, dicts.Serve("users", map[string]any{"id": 1}, map[string]any{"id": 2}))
+
+		standIns := stub.standIns(map[string]DictionaryStandIn{"": StandInHTTP}, "db")
+		assert.Equal(t, StandInHTTP, standIns.Default)
+
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, standIns.URL+"/users", nil)
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "{\"id\":1}\n{\"id\":2}\n", string(data))
+	})
+
+	t.Run("should be able to reload dictionaries", func(t *testing.T) {
+		conn := NewMockConn(t)
+		dicts := &Dictionaries{conn: conn, database: "db"}
+
+		conn.EXPECT().Exec(mock.Anything, "SYSTEM RELOAD DICTIONARY `db`.`users`").Return(nil).Twice()
+		conn.EXPECT().
+			Select(mock.Anything, mock.Anything, "SELECT name FROM system.dictionaries WHERE database = ?", []any{"db"}).
+			RunAndReturn(func(ctx context.Context, dest any, query string, args ...any) error {
+				*dest.(*[]systemDictionary) = []systemDictionary{{Name: "users"}}
+				return nil
+			})
+
+		require.NoError(t, dicts.Reload(t.Context(), "users"))
+		require.NoError(t, dicts.Reload(t.Context()))
+		assert.Equal(t, "`db`.`users_source`", dicts.Table("users"))
+	})
+
+	t.Run("should be able failed to serve without stub", func(t *testing.T) {
+		require.ErrorIs(t, (&Dictionaries{}).Serve("users"), ErrDictionaryStubDisabled)
+	})
+
+	t.Run("should be able to resolve stub host in container", func(t *testing.T) {
+		req := testcontainers.GenericContainerRequest{}
+		require.NoError(t, hostGateway(defaultDictionaryStubHost)(&req))
+
+		hostConfig := &container.HostConfig{}
+		req.HostConfigModifier(hostConfig)
+		assert.Equal(t, []string{"host.docker.internal:host-gateway"}, hostConfig.ExtraHosts)
+	})
+
+	t.Run("should be able to listen stub on loopback when docker gateway unavailable", func(t *testing.T) {
+		for name, gateway := range map[string]func(ctx context.Context) (string, error){
+			"when gateway unknown": func(ctx context.Context) (string, error) {
+				return "", assert.AnError
+			},
+			"when gateway isn't local": func(ctx context.Context) (string, error) {
+				return "192.0.2.1", nil
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				stub, err := startContainerDictionaryStub(t.Context(), gateway, defaultDictionaryStubHost)
+				require.NoError(t, err)
+
+				stubURL, err := url.Parse(stub.url)
+				require.NoError(t, err)
+				assert.Equal(t, defaultDictionaryStubHost, stubURL.Hostname())
+
+				conn, err := (&net.Dialer{}).DialContext(t.Context(), "tcp", net.JoinHostPort(loopbackAddress, stubURL.Port()))
+				require.NoError(t, err)
+				require.NoError(t, conn.Close())
+			})
+		}
+	})
+
+	t.Run("should be able to reject hosted mode without stub host", func(t *testing.T) {
+		cfg := config{hostedDBNamespace: "ns"}
+		WithDictionaryStandIn(StandInHTTP)(&cfg)
+
+		_, err := hostedBootstrapper[struct{}](cfg)(t.Context())
+		require.ErrorIs(t, err, ErrDictionaryStubHostRequired)
+	})
+
+	t.Run("should be able to detect http stand-ins", func(t *testing.T) {
+		cfg := config{}
+		WithDictionaryStandIn(StandInTable, "countries")(&cfg)
+		assert.False(t, cfg.usesDictionaryStub())
+
+		WithDictionaryStandIn(StandInHTTP)(&cfg)
+		assert.True(t, cfg.usesDictionaryStub())
+	})
+}
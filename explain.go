@@ -0,0 +1,255 @@
+package groclick
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	explainIndexPrimaryKey = "PrimaryKey"
+	explainIndexPartition  = "Partition"
+	explainIndexMinMax     = "MinMax"
+	explainIndexSkip       = "Skip"
+	explainReadMergeTree   = "ReadFromMergeTree"
+	explainTrueCondition   = "true"
+)
+
+var (
+	ErrExplainEmptyPlan    = errors.New("explain returned empty plan")
+	ErrExplainNoTableReads = errors.New("query plan doesn't read any MergeTree table")
+	ErrExplainMismatch     = errors.New("query plan mismatch")
+)
+
+type (
+	ExplainIndex struct {
+		Type             string   `json:"Type"`
+		Name             string   `json:"Name"`
+		Description      string   `json:"Description"`
+		Keys             []string `json:"Keys"`
+		Condition        string   `json:"Condition"`
+		InitialParts     int      `json:"Initial Parts"`
+		SelectedParts    int      `json:"Selected Parts"`
+		InitialGranules  int      `json:"Initial Granules"`
+		SelectedGranules int      `json:"Selected Granules"`
+	}
+
+	ExplainRead struct {
+		Table   string
+		Indexes []ExplainIndex
+	}
+
+	QueryPlan struct {
+		Reads    []ExplainRead
+		Rendered string
+	}
+
+	explainNode struct {
+		NodeType    string         `json:"Node Type"`
+		Description string         `json:"Description"`
+		Indexes     []ExplainIndex `json:"Indexes"`
+		Plans       []explainNode  `json:"Plans"`
+	}
+
+	explainLine struct {
+		Explain string `ch:"explain"`
+	}
+)
+
+func (c *Connect) Explain(ctx context.Context, query string, args ...any) (*QueryPlan, error) {
+	var rows []explainLine
+
+	if err := c.Select(ctx, &rows, "EXPLAIN PLAN json = 1, indexes = 1 "+query, args...); err != nil {
+		return nil, fmt.Errorf("can't explain query plan: %w", err)
+	}
+
+	if len(rows) == 0 {
+		return nil, ErrExplainEmptyPlan
+	}
+
+	plan, err := parseQueryPlan(rows[0].Explain)
+	if err != nil {
+		return nil, err
+	}
+
+	rows = rows[:0]
+	if err := c.Select(ctx, &rows, "EXPLAIN PLAN indexes = 1 "+query, args...); err != nil {
+		return nil, fmt.Errorf("can't render query plan: %w", err)
+	}
+
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		lines = append(lines, row.Explain)
+	}
+
+	plan.Rendered = strings.Join(lines, "\n")
+
+	return plan, nil
+}
+
+func (c *Connect) AssertUsesPrimaryKey(t *testing.T, query string, args ...any) {
+	t.Helper()
+
+	plan, err := c.Explain(t.Context(), query, args...)
+	require.NoError(t, err)
+	require.NoError(t, plan.CheckUsesPrimaryKey())
+}
+
+func (c *Connect) AssertUsesSkipIndex(t *testing.T, name string, query string, args ...any) {
+	t.Helper()
+
+	plan, err := c.Explain(t.Context(), query, args...)
+	require.NoError(t, err)
+	require.NoError(t, plan.CheckUsesSkipIndex(name))
+}
+
+func (c *Connect) AssertPartsPruned(t *testing.T, minRatio float64, query string, args ...any) {
+	t.Helper()
+
+	plan, err := c.Explain(t.Context(), query, args...)
+	require.NoError(t, err)
+	require.NoError(t, plan.CheckPartsPruned(minRatio))
+}
+
+func (c *Connect) AssertPartitionsPruned(t *testing.T, minRatio float64, query string, args ...any) {
+	t.Helper()
+
+	plan, err := c.Explain(t.Context(), query, args...)
+	require.NoError(t, err)
+	require.NoError(t, plan.CheckPartitionsPruned(minRatio))
+}
+
+func parseQueryPlan(raw string) (*QueryPlan, error) {
+	var nodes []struct {
+		Plan explainNode `json:"Plan"`
+	}
+
+	if err := json.Unmarshal([]byte(raw), &nodes); err != nil {
+		return nil, fmt.Errorf("can't parse query plan: %w", err)
+	}
+
+	if len(nodes) == 0 {
+		return nil, ErrExplainEmptyPlan
+	}
+
+	plan := &QueryPlan{}
+	for _, node := range nodes {
+		plan.Reads = collectReads(node.Plan, plan.Reads)
+	}
+
+	return plan, nil
+}
+
+func collectReads(node explainNode, reads []ExplainRead) []ExplainRead {
+	if node.NodeType == explainReadMergeTree {
+		reads = append(reads, ExplainRead{
+			Table:   node.Description,
+			Indexes: node.Indexes,
+		})
+	}
+
+	for _, child := range node.Plans {
+		reads = collectReads(child, reads)
+	}
+
+	return reads
+}
+
+func (p *QueryPlan) CheckUsesPrimaryKey() error {
+	if len(p.Reads) == 0 {
+		return p.mismatch(ErrExplainNoTableReads)
+	}
+
+	for _, read := range p.Reads {
+		idx, ok := read.index(explainIndexPrimaryKey, "")
+		if !ok || len(idx.Keys) == 0 || idx.Condition == "" || idx.Condition == explainTrueCondition {
+			return p.mismatch(fmt.Errorf("%w: table %s doesn't use primary key", ErrExplainMismatch, read.Table))
+		}
+	}
+
+	return nil
+}
+
+func (p *QueryPlan) CheckUsesSkipIndex(name string) error {
+	for _, read := range p.Reads {
+		idx, ok := read.index(explainIndexSkip, name)
+		if ok && idx.SelectedGranules < idx.InitialGranules {
+			return nil
+		}
+	}
+
+	return p.mismatch(fmt.Errorf("%w: skip index %s doesn't filter any granules", ErrExplainMismatch, name))
+}
+
+func (p *QueryPlan) CheckPartsPruned(minRatio float64) error {
+	if len(p.Reads) == 0 {
+		return p.mismatch(ErrExplainNoTableReads)
+	}
+
+	initial, selected := 0, 0
+	for _, read := range p.Reads {
+		if len(read.Indexes) == 0 {
+			continue
+		}
+		initial += read.Indexes[0].InitialParts
+		selected += read.Indexes[len(read.Indexes)-1].SelectedParts
+	}
+
+	return p.checkRatio("parts", initial, selected, minRatio)
+}
+
+func (p *QueryPlan) CheckPartitionsPruned(minRatio float64) error {
+	if len(p.Reads) == 0 {
+		return p.mismatch(ErrExplainNoTableReads)
+	}
+
+	initial, selected := 0, 0
+	for _, read := range p.Reads {
+		for _, idx := range read.Indexes {
+			if idx.Type != explainIndexPartition && idx.Type != explainIndexMinMax {
+				continue
+			}
+			initial += idx.InitialParts
+			selected += idx.SelectedParts
+
+			break
+		}
+	}
+
+	return p.checkRatio("partitions", initial, selected, minRatio)
+}
+
+func (p *QueryPlan) checkRatio(what string, initial, selected int, minRatio float64) error {
+	ratio := 0.0
+	if initial > 0 {
+		ratio = 1 - float64(selected)/float64(initial)
+	}
+
+	if ratio < minRatio {
+		return p.mismatch(fmt.Errorf(
+			"%w: %s pruned ratio=%.2f (selected %d of %d) less than expected %.2f",
+			ErrExplainMismatch, what, ratio, selected, initial, minRatio,
+		))
+	}
+
+	return nil
+}
+
+func (p *QueryPlan) mismatch(err error) error {
+	return fmt.Errorf("%w\n%s", err, p.Rendered)
+}
+
+func (r ExplainRead) index(kind, name string) (ExplainIndex, bool) {
+	for _, idx := range r.Indexes {
+		if idx.Type == kind && (name == "" || idx.Name == name) {
+			return idx, true
+		}
+	}
+
+	return ExplainIndex{}, false
+}
@@ -0,0 +1,167 @@
+package groclick
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const explainJSONPlan = `[
+  {
+    "Plan": {
+      "Node Type": "Expression",
+      "Plans": [
+        {
+          "Node Type": "ReadFromMergeTree",
+          "Description": "default.groclick",
+          "Indexes": [
+            {"Type": "MinMax", "Keys": ["ts"], "Condition": "(ts in [1, +Inf))",
+             "Initial Parts": 10, "Selected Parts": 5, "Initial Granules": 20, "Selected Granules": 10},
+            {"Type": "Partition", "Keys": ["toYYYYMM(ts)"], "Condition": "true",
+             "Initial Parts": 5, "Selected Parts": 5, "Initial Granules": 10, "Selected Granules": 10},
+            {"Type": "PrimaryKey", "Keys": ["id"], "Condition": "(id in [1, 1])",
+             "Initial Parts": 5, "Selected Parts": 2, "Initial Granules": 10, "Selected Granules": 2},
+            {"Type": "Skip", "Name": "clicks_idx", "Description": "minmax GRANULARITY 1",
+             "Initial Parts": 2, "Selected Parts": 1, "Initial Granules": 2, "Selected Granules": 1}
+          ]
+        }
+      ]
+    }
+  }
+]`
+
+const explainJSONFullScan = `[
+  {
+    "Plan": {
+      "Node Type": "ReadFromMergeTree",
+      "Description": "default.groclick",
+      "Indexes": [
+        {"Type": "PrimaryKey", "Condition": "true",
+         "Initial Parts": 4, "Selected Parts": 4, "Initial Granules": 8, "Selected Granules": 8}
+      ]
+    }
+  }
+]`
+
+func arrangeExplain(conn *MockConn, plan string, err error) {
+	conn.EXPECT().
+		Select(mock.Anything, mock.Anything, "EXPLAIN PLAN json = 1, indexes = 1 SELECT 1").
+		RunAndReturn(func(ctx context.Context, dest any, query string, args ...any) error {
+			*dest.(*[]explainLine) = []explainLine{{Explain: plan}}
+			return err
+		}).Maybe()
+	conn.EXPECT().
+		Select(mock.Anything, mock.Anything, "EXPLAIN PLAN indexes = 1 SELECT 1").
+		RunAndReturn(func(ctx context.Context, dest any, query string, args ...any) error {
+			*dest.(*[]explainLine) = []explainLine{{Explain: "ReadFromMergeTree (default.groclick)"}}
+			return nil
+		}).Maybe()
+}
+
+func TestConnect_Explain(t *testing.T) {
+	t.Run("should be able to explain query plan", func(t *testing.T) {
+		conn := NewMockConn(t)
+		arrangeExplain(conn, explainJSONPlan, nil)
+
+		plan, err := (&Connect{conn}).Explain(t.Context(), "SELECT 1")
+		require.NoError(t, err)
+		require.Len(t, plan.Reads, 1)
+		assert.Equal(t, "default.groclick", plan.Reads[0].Table)
+		assert.Len(t, plan.Reads[0].Indexes, 4)
+		assert.Equal(t, "ReadFromMergeTree (default.groclick)", plan.Rendered)
+	})
+
+	t.Run("should be able to assert", func(t *testing.T) {
+		conn := NewMockConn(t)
+		arrangeExplain(conn, explainJSONPlan, nil)
+		click := &Connect{conn}
+
+		click.AssertUsesPrimaryKey(t, "SELECT 1")
+		click.AssertUsesSkipIndex(t, "clicks_idx", "SELECT 1")
+		click.AssertPartsPruned(t, 0.8, "SELECT 1")
+		click.AssertPartitionsPruned(t, 0.5, "SELECT 1")
+	})
+
+	t.Run("should be able failed", func(t *testing.T) {
+		t.Run("when can't explain query", func(t *testing.T) {
+			conn := NewMockConn(t)
+			exp := errors.New(uuid.NewString())
+			arrangeExplain(conn, "", exp)
+
+			_, err := (&Connect{conn}).Explain(t.Context(), "SELECT 1")
+			require.ErrorIs(t, err, exp)
+		})
+
+		t.Run("when explain returns no rows", func(t *testing.T) {
+			conn := NewMockConn(t)
+			conn.EXPECT().Select(mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+			_, err := (&Connect{conn}).Explain(t.Context(), "SELECT 1")
+			require.ErrorIs(t, err, ErrExplainEmptyPlan)
+		})
+
+		t.Run("when explain returns invalid json", func(t *testing.T) {
+			conn := NewMockConn(t)
+			arrangeExplain(conn, uuid.NewString(), nil)
+
+			_, err := (&Connect{conn}).Explain(t.Context(), "SELECT 1")
+			require.ErrorContains(t, err, "can't parse query plan")
+		})
+
+		t.Run("when can't render query plan", func(t *testing.T) {
+			conn := NewMockConn(t)
+			exp := errors.New(uuid.NewString())
+			conn.EXPECT().
+				Select(mock.Anything, mock.Anything, "EXPLAIN PLAN json = 1, indexes = 1 SELECT 1").
+				RunAndReturn(func(ctx context.Context, dest any, query string, args ...any) error {
+					*dest.(*[]explainLine) = []explainLine{{Explain: explainJSONPlan}}
+					return nil
+				})
+			conn.EXPECT().
+				Select(mock.Anything, mock.Anything, "EXPLAIN PLAN indexes = 1 SELECT 1").
+				Return(exp)
+
+			_, err := (&Connect{conn}).Explain(t.Context(), "SELECT 1")
+			require.ErrorIs(t, err, exp)
+		})
+	})
+}
+
+func TestQueryPlan_Check(t *testing.T) {
+	full, err := parseQueryPlan(explainJSONFullScan)
+	require.NoError(t, err)
+	full.Rendered = "rendered plan"
+
+	empty := &QueryPlan{}
+
+	t.Run("should be able to fail with rendered plan", func(t *testing.T) {
+		err := full.CheckUsesPrimaryKey()
+		require.ErrorIs(t, err, ErrExplainMismatch)
+		assert.ErrorContains(t, err, "rendered plan")
+	})
+
+	t.Run("should be able to fail when skip index not used", func(t *testing.T) {
+		require.ErrorIs(t, full.CheckUsesSkipIndex("clicks_idx"), ErrExplainMismatch)
+	})
+
+	t.Run("should be able to fail when parts not pruned", func(t *testing.T) {
+		require.ErrorIs(t, full.CheckPartsPruned(0.1), ErrExplainMismatch)
+		require.ErrorIs(t, full.CheckPartitionsPruned(0.1), ErrExplainMismatch)
+	})
+
+	t.Run("should be able to fail when plan has no reads", func(t *testing.T) {
+		require.ErrorIs(t, empty.CheckUsesPrimaryKey(), ErrExplainNoTableReads)
+		require.ErrorIs(t, empty.CheckPartsPruned(0), ErrExplainNoTableReads)
+		require.ErrorIs(t, empty.CheckPartitionsPruned(0), ErrExplainNoTableReads)
+	})
+
+	t.Run("should be able to fail on empty plan", func(t *testing.T) {
+		_, err := parseQueryPlan("[]")
+		require.ErrorIs(t, err, ErrExplainEmptyPlan)
+	})
+}
@@ -0,0 +1,525 @@
+package groclick
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/godepo/groat/pkg/ctxgroup"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	maxDatabaseNameLength = 128
+	runIDLength           = 8
+)
+
+type (
+	systemTable struct {
+		Name   string `ch:"name"`
+		Engine string `ch:"engine"`
+	}
+
+	systemDictionary struct {
+		Name string `ch:"name"`
+	}
+)
+
+type forker struct {
+	root            driver.Conn
+	ctx             context.Context
+	dsn             string
+	namespace       string
+	forks           *atomic.Int32
+	runID           string
+	stamp           bool
+	cluster         string
+	ddlTimeout      time.Duration
+	tls             *tls.Config
+	settings        clickhouse.Settings
+	testSettings    func(t *testing.T) clickhouse.Settings
+	databases       []LogicalDatabase
+	connConstructor func(opt *clickhouse.Options) (driver.Conn, error)
+	logger          *slog.Logger
+	tracer          trace.Tracer
+	timings         *timings
+	rewrite         []string
+	kafka           *redpandaCompanion
+	standIns        map[string]DictionaryStandIn
+	stub            *dictionaryStub
+	functions       []string
+	limiter         forkLimiter
+
+	mu       sync.Mutex
+	retained []string
+	live     map[string]bool
+	leased   map[*testing.T]clickhouse.Settings
+}
+
+func newForker(ctx context.Context, root driver.Conn, dsn, namespace string, cfg config) *forker {
+	if cfg.runID == "" {
+		cfg.runID = newRunID()
+	}
+
+	return &forker{
+		root:            root,
+		ctx:             ctx,
+		dsn:             dsn,
+		namespace:       namespace,
+		forks:           &atomic.Int32{},
+		runID:           cfg.runID,
+		settings:        cfg.settings,
+		testSettings:    cfg.testSettings,
+		databases:       cfg.logicalDatabases(),
+		connConstructor: cfg.connConstructor,
+		logger:          cfg.log(),
+		tracer:          cfg.tracer(),
+		timings:         cfg.timings,
+		rewrite:         cfg.databaseRewrite,
+		kafka:           cfg.companions.redpanda(),
+		standIns:        cfg.dictionaryStandIns,
+		stub:            cfg.dictionaryStub,
+		functions:       cfg.functions,
+		limiter:         newForkLimiter(cfg.maxConcurrentForks),
+	}
+}
+
+func (f *forker) fork(
+	t *testing.T,
+	label string,
+	settings clickhouse.Settings,
+	created func(name string),
+) forkedDatabases {
+	t.Helper()
+
+	ctx, cancel := testContext(f.ctx, t)
+	defer cancel()
+
+	ctx, span := f.tracer.Start(ctx, "groclick.database.fork", trace.WithAttributes(
+		attribute.String("test", t.Name()),
+		attribute.String("label", label),
+	))
+	defer span.End()
+
+	release, err := f.limiter.acquire(ctx)
+	require.NoError(t, err)
+	defer release()
+
+	res := make(forkedDatabases, 0, len(f.databases))
+
+	for i, db := range f.databases {
+		dbLabel := label
+		if db.Name != "" {
+			dbLabel = db.Name + "_" + label
+		}
+
+		cfg, con := f.create(ctx, t, dbLabel, i == 0, settings, created)
+		res = append(res, forkedDatabase{name: db.Name, cfg: cfg, conn: con})
+	}
+
+	mapping := databaseMapping(f.rewrite, res.primary().cfg.Auth.Database)
+	for _, db := range res {
+		if db.name == "" {
+			continue
+		}
+
+		if mapping == nil {
+			mapping = make(map[string]string, len(res))
+		}
+
+		mapping[db.name] = db.cfg.Auth.Database
+	}
+
+	if f.kafka != nil {
+		kafka, err := f.kafka.create(ctx, res.primary().cfg.Auth.Database)
+		require.NoError(t, err)
+
+		res[0].kafka = kafka
+	}
+
+	for i, db := range f.databases {
+		f.migrate(ctx, t, db, res[i], mapping, res.primary().kafka.variables(), f.functionsOf(res))
+	}
+
+	return res
+}
+
+func (f *forker) create(
+	ctx context.Context,
+	t *testing.T,
+	label string,
+	primary bool,
+	settings clickhouse.Settings,
+	created func(name string),
+) (*clickhouse.Options, driver.Conn) {
+	t.Helper()
+
+	startedAt := time.Now()
+
+	cfg, err := clickhouse.ParseDSN(f.dsn)
+	require.NoError(t, err)
+	applyTLS(cfg, f.tls)
+	cfg.Settings = mergeSettings(cfg.Settings, f.settings, settings)
+
+	cfg.Auth.Database = f.databaseName(cfg.Auth.Database, label)
+
+	query := "CREATE DATABASE " + quoteIdentifier(cfg.Auth.Database) + onClusterClause(f.cluster)
+	if f.stamp {
+		query += " COMMENT " + quoteString(databaseStamp(f.runID, time.Now()))
+	}
+
+	createCtx, createSpan := startSpan(ctx, "groclick.database.create", attribute.String("db.name", cfg.Auth.Database))
+	err = f.root.Exec(createCtx, query)
+	endSpan(createSpan, err)
+
+	if err != nil {
+		f.logger.Error("can't create database",
+			slog.String("test", t.Name()),
+			slog.String("database", cfg.Auth.Database),
+			slog.Any("error", err),
+		)
+	}
+	require.NoError(t, err,
+		"can't created database=%s for user %s",
+		cfg.Auth.Database, cfg.Auth.Username,
+	)
+
+	f.track(cfg.Auth.Database, primary)
+
+	if created != nil {
+		created(cfg.Auth.Database)
+	}
+
+	connCtx, connSpan := startSpan(ctx, "groclick.connect", attribute.String("db.name", cfg.Auth.Database))
+	con, err := f.connConstructor(cfg)
+	if err == nil {
+		err = con.Ping(connCtx)
+	}
+	endSpan(connSpan, err)
+	require.NoError(t, err)
+
+	f.timings.since(PhaseDatabaseCreate, startedAt)
+
+	f.logger.Debug("database created",
+		slog.String("test", t.Name()),
+		slog.String("database", cfg.Auth.Database),
+		slog.Duration("duration", time.Since(startedAt)),
+	)
+
+	return cfg, con
+}
+
+func (f *forker) migrate(
+	ctx context.Context,
+	t *testing.T,
+	logical LogicalDatabase,
+	db forkedDatabase,
+	mapping map[string]string,
+	variables map[string]string,
+	functions Functions,
+) {
+	t.Helper()
+
+	migratedAt := time.Now()
+	cfg := db.cfg
+
+	migrateCtx, migrateSpan := startSpan(ctx, "groclick.migrate", attribute.String("db.name", cfg.Auth.Database))
+	err := logical.Migrator(migrateCtx, MigratorConfig{
+		Config:    cfg,
+		DB:        db.conn,
+		DBName:    cfg.Auth.Database,
+		Path:      logical.MigrationsPath,
+		UserName:  cfg.Auth.Username,
+		Password:  cfg.Auth.Password,
+		Cluster:   f.cluster,
+		Logger:    f.logger,
+		Databases: mapping,
+		Variables: variables,
+		StandIns:  f.stub.standIns(f.standIns, cfg.Auth.Database),
+		Functions: functions,
+	})
+	endSpan(migrateSpan, err)
+
+	if err != nil {
+		f.logger.Error("can't apply migrations",
+			slog.String("test", t.Name()),
+			slog.String("database", cfg.Auth.Database),
+			slog.Any("error", err),
+		)
+	}
+	require.NoError(t, err)
+
+	if f.cluster != "" {
+		require.NoError(t, waitDistributedDDL(ctx, f.root, cfg.Auth.Database, f.ddlTimeout))
+	}
+
+	f.timings.since(PhaseMigrate, migratedAt)
+
+	f.logger.Debug("migrations applied",
+		slog.String("test", t.Name()),
+		slog.String("database", cfg.Auth.Database),
+		slog.Duration("duration", time.Since(migratedAt)),
+	)
+}
+
+func (f *forker) drop(ctx context.Context, name string) error {
+	startedAt := time.Now()
+
+	ctx, span := f.tracer.Start(ctx, "groclick.database.drop", trace.WithAttributes(attribute.String("db.name", name)))
+
+	err := f.root.Exec(ctx, "DROP DATABASE "+quoteIdentifier(name)+onClusterClause(f.cluster))
+	if f.primary(name) {
+		for _, function := range functionMapping(f.functions, name) {
+			err = errors.Join(err, f.root.Exec(ctx,
+				"DROP FUNCTION IF EXISTS "+quoteIdentifier(function)+onClusterClause(f.cluster)))
+		}
+	}
+	endSpan(span, err)
+	f.timings.since(PhaseDrop, startedAt)
+
+	if err != nil {
+		f.logger.Warn("can't drop database", slog.String("database", name), slog.Any("error", err))
+
+		return err
+	}
+
+	f.untrack(name)
+
+	f.logger.Debug("database dropped", slog.String("database", name), slog.Duration("duration", time.Since(startedAt)))
+
+	return nil
+}
+
+// functionsOf returns names of namespaced functions, they are prefixed with name of primary database.
+func (f *forker) functionsOf(dbs forkedDatabases) Functions {
+	return functionMapping(f.functions, dbs.primary().cfg.Auth.Database)
+}
+
+func (f *forker) databaseName(base, label string) string {
+	prefix := f.namespace + base + "_"
+	suffix := fmt.Sprintf("_%s_%d", f.runID, f.forks.Add(1))
+
+	label = sanitizeIdentifier(label)
+	if free := maxDatabaseNameLength - len(prefix) - len(suffix); len(label) > free {
+		label = strings.TrimRight(label[:max(free, 0)], "_")
+	}
+
+	if label == "" {
+		return prefix + suffix[1:]
+	}
+
+	return prefix + label + suffix
+}
+
+func (f *forker) dropOnCleanup(t *testing.T) func(name string) {
+	return func(name string) {
+		t.Cleanup(func() {
+			err := f.drop(f.ctx, name)
+			if err != nil {
+				t.Logf("can't cleanup database %s: %v", name, err)
+			}
+		})
+	}
+}
+
+// track registers created database, namespaced functions are created only for primary database.
+func (f *forker) track(name string, primary bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.live == nil {
+		f.live = make(map[string]bool)
+	}
+
+	f.live[name] = primary
+}
+
+func (f *forker) primary(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.live[name]
+}
+
+func (f *forker) untrack(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.live, name)
+}
+
+// remaining returns databases created by forker and not dropped yet.
+func (f *forker) remaining() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	res := make([]string, 0, len(f.live))
+	for name := range f.live {
+		res = append(res, name)
+	}
+
+	slices.Sort(res)
+
+	return res
+}
+
+func (f *forker) dropRemaining(ctx context.Context) error {
+	errs := make([]error, 0)
+
+	for _, name := range f.remaining() {
+		if err := f.drop(ctx, name); err != nil {
+			errs = append(errs, fmt.Errorf("can't drop database %s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (f *forker) retain(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.retained = append(f.retained, name)
+}
+
+func (f *forker) release(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, retained := range f.retained {
+		if retained == name {
+			f.retained = append(f.retained[:i], f.retained[i+1:]...)
+
+			return
+		}
+	}
+}
+
+func (f *forker) dropRetained() {
+	ctxgroup.IncAt(f.ctx)
+
+	go func() {
+		defer ctxgroup.DoneFrom(f.ctx)
+
+		<-f.ctx.Done()
+
+		// drop untracks database under the same mutex, so retained list is detached before dropping
+		f.mu.Lock()
+		retained := f.retained
+		f.retained = nil
+		f.mu.Unlock()
+
+		for _, name := range retained {
+			_ = f.drop(context.Background(), name) //nolint:contextcheck
+		}
+	}()
+}
+
+func truncateDatabase(ctx context.Context, conn driver.Conn, name, cluster string) error {
+	var tables []systemTable
+
+	err := conn.Select(ctx, &tables, "SELECT name, engine FROM system.tables WHERE database = ?", name)
+	if err != nil {
+		return fmt.Errorf("can't list tables of database %s: %w", name, err)
+	}
+
+	for _, table := range tables {
+		if !truncatableEngine(table.Engine) {
+			continue
+		}
+
+		err := conn.Exec(
+			ctx,
+			"TRUNCATE TABLE "+quoteIdentifier(name)+"."+quoteIdentifier(table.Name)+onClusterClause(cluster),
+		)
+		if err != nil {
+			return fmt.Errorf("can't truncate table %s.%s: %w", name, table.Name, err)
+		}
+	}
+
+	return reloadDictionaries(ctx, conn, name, cluster)
+}
+
+func reloadDictionaries(ctx context.Context, conn driver.Conn, name, cluster string) error {
+	var dictionaries []systemDictionary
+
+	err := conn.Select(ctx, &dictionaries, "SELECT name FROM system.dictionaries WHERE database = ?", name)
+	if err != nil {
+		return fmt.Errorf("can't list dictionaries of database %s: %w", name, err)
+	}
+
+	for _, dict := range dictionaries {
+		if err := reloadDictionary(ctx, conn, name, dict.Name, cluster); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func reloadDictionary(ctx context.Context, conn driver.Conn, database, name, cluster string) error {
+	err := conn.Exec(
+		ctx,
+		"SYSTEM RELOAD DICTIONARY"+onClusterClause(cluster)+" "+quoteIdentifier(database)+"."+quoteIdentifier(name),
+	)
+	if err != nil {
+		return fmt.Errorf("can't reload dictionary %s.%s: %w", database, name, err)
+	}
+
+	return nil
+}
+
+func truncatableEngine(engine string) bool {
+	if strings.HasSuffix(engine, "MergeTree") {
+		return true
+	}
+
+	switch engine {
+	case "Memory", "Log", "TinyLog", "StripeLog", "Set", "Join":
+		return true
+	default:
+		return false
+	}
+}
+
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(strings.ReplaceAll(name, `\`, `\\`), "`", "\\`") + "`"
+}
+
+func sanitizeIdentifier(name string) string {
+	var builder strings.Builder
+
+	underscore := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			builder.WriteRune(r)
+			underscore = false
+
+			continue
+		}
+
+		if !underscore {
+			builder.WriteRune('_')
+			underscore = true
+		}
+	}
+
+	return strings.Trim(builder.String(), "_")
+}
+
+func newRunID() string {
+	return strings.ReplaceAll(uuid.NewString(), "-", "")[:runIDLength]
+}
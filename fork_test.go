@@ -0,0 +1,43 @@
+package groclick
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruncatableEngine(t *testing.T) {
+	assert.True(t, truncatableEngine("ReplacingMergeTree"))
+	assert.True(t, truncatableEngine("Memory"))
+	assert.False(t, truncatableEngine("MaterializedView"))
+	assert.False(t, truncatableEngine("Dictionary"))
+}
+
+func TestForker_DatabaseName(t *testing.T) {
+	t.Run("should be able to derive name from test name", func(t *testing.T) {
+		fork := newForker(t.Context(), nil, isolationDSN, "ns_", config{runID: "run"})
+
+		assert.Equal(t, "ns_groclick_testforker_databasename_run_1", fork.databaseName("groclick", "TestForker/DatabaseName"))
+		assert.Equal(t, "ns_groclick_run_2", fork.databaseName("groclick", "#/"))
+	})
+
+	t.Run("should be able to respect identifier length limit", func(t *testing.T) {
+		fork := newForker(t.Context(), nil, isolationDSN, "", config{runID: "run"})
+
+		name := fork.databaseName("groclick", strings.Repeat("a", maxDatabaseNameLength))
+		assert.Len(t, name, maxDatabaseNameLength)
+		assert.True(t, strings.HasSuffix(name, "_run_1"))
+	})
+
+	t.Run("should be able to generate run id", func(t *testing.T) {
+		fork := newForker(t.Context(), nil, isolationDSN, "", config{})
+
+		assert.Len(t, fork.runID, runIDLength)
+	})
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	assert.Equal(t, "`db`", quoteIdentifier("db"))
+	assert.Equal(t, "`d\\`b\\\\`", quoteIdentifier("d`b\\"))
+}
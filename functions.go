@@ -0,0 +1,224 @@
+package groclick
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/godepo/groclick/internal/pkg/sqltoken"
+	"github.com/spf13/afero"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+const (
+	userScriptsDir          = "/var/lib/clickhouse/user_scripts"
+	executableFunctionsDir  = "/etc/clickhouse-server/groclick_functions"
+	executableFunctionsPath = "/etc/clickhouse-server/config.d/groclick-functions.xml"
+	userScriptFileMode      = 0o755
+)
+
+var ErrExecutableUDFRequiresContainer = errors.New("executable user defined functions require clickhouse container")
+
+// Functions maps SQL user defined function created by migrations to its name in forked database.
+type Functions map[string]string
+
+// WithFunctionNamespacing prefixes SQL user defined functions created by migrations with name of forked
+// database and rewrites their call sites, so forks don't clash on server-global functions. Functions of
+// plain migrations are found automatically, functions created by custom migrators should be listed.
+func WithFunctionNamespacing(functions ...string) Option {
+	return func(c *config) {
+		c.functionNamespacing = true
+		c.functions = append(c.functions, functions...)
+	}
+}
+
+// WithExecutableUDFs ships executable user defined functions from dir into container: XML files are
+// function definitions, other files are scripts copied to user_scripts.
+func WithExecutableUDFs(dir string) Option {
+	return func(c *config) {
+		c.executableUDFs = dir
+	}
+}
+
+func WithInjectLabelForFunctions(label string) Option {
+	return func(c *config) {
+		c.injectLabelForFuncs = label
+	}
+}
+
+// Name returns name of function in forked database, functions created without namespacing keep their names.
+func (f Functions) Name(function string) string {
+	if name, ok := f[function]; ok {
+		return name
+	}
+
+	return function
+}
+
+// RewriteFunctions replaces names of functions from mapping keys with values in CREATE and DROP FUNCTION
+// statements and call sites.
+func RewriteFunctions(statement string, mapping map[string]string) string {
+	if len(mapping) == 0 {
+		return statement
+	}
+
+	tokens := sqltoken.Tokenize(statement)
+	words := sqltoken.Significant(tokens)
+	word := func(i int) *sqltoken.Token {
+		if i < 0 || i >= len(words) {
+			return &sqltoken.Token{}
+		}
+
+		return &tokens[words[i]]
+	}
+
+	for i := range words {
+		token := word(i)
+		if !token.IsIdentifier() {
+			continue
+		}
+
+		target, ok := mapping[token.Value()]
+		if !ok {
+			continue
+		}
+
+		called := word(i+1).Text == "(" && word(i-1).Text != "."
+		if called || functionDeclaration(word, i) {
+			token.Text = quoteIdentifier(target)
+		}
+	}
+
+	return sqltoken.Join(tokens)
+}
+
+// functionDeclaration reports function name in CREATE [OR REPLACE] FUNCTION [IF [NOT] EXISTS] name and DROP.
+func functionDeclaration(word func(i int) *sqltoken.Token, at int) bool {
+	pos := at - 1
+	if word(pos).Is("EXISTS") {
+		pos--
+		if word(pos).Is("NOT") {
+			pos--
+		}
+
+		if !word(pos).Is("IF") {
+			return false
+		}
+		pos--
+	}
+
+	return word(pos).Is("FUNCTION") && word(pos-1).Is("CREATE", "REPLACE", "DROP")
+}
+
+func createdFunctions(sql string) []string {
+	res := make([]string, 0)
+
+	for _, tokens := range sqltoken.Split(sql) {
+		words := sqltoken.Significant(tokens)
+		for i := 0; i < len(words); i++ {
+			if !tokens[words[i]].Is("FUNCTION") {
+				continue
+			}
+
+			at := i + 1
+			if at < len(words) && tokens[words[at]].Is("IF") {
+				at += 3
+			}
+
+			if i > 0 && tokens[words[0]].Is("CREATE") && at < len(words) && tokens[words[at]].IsIdentifier() {
+				res = append(res, tokens[words[at]].Value())
+			}
+
+			break
+		}
+	}
+
+	return res
+}
+
+// discoverFunctions collects functions created by plain migrations when namespacing is enabled.
+func discoverFunctions(cfg *config, paths ...string) error {
+	if !cfg.functionNamespacing {
+		return nil
+	}
+
+	for _, dir := range paths {
+		files, err := readMigrations(cfg.fs, dir)
+		if err != nil {
+			return err
+		}
+
+		for _, file := range files {
+			cfg.functions = append(cfg.functions, createdFunctions(file.data)...)
+		}
+	}
+
+	slices.Sort(cfg.functions)
+	cfg.functions = slices.Compact(cfg.functions)
+
+	return nil
+}
+
+func functionMapping(functions []string, database string) Functions {
+	if len(functions) == 0 {
+		return nil
+	}
+
+	res := make(Functions, len(functions))
+	for _, function := range functions {
+		res[function] = database + "_" + function
+	}
+
+	return res
+}
+
+func executableUDFs(fs afero.Fs, dir string) (testcontainers.CustomizeRequestOption, error) {
+	list, err := afero.ReadDir(fs, dir)
+	if err != nil {
+		return nil, fmt.Errorf("can't read executable udfs dir: %w", err)
+	}
+
+	files := []testcontainers.ContainerFile{{
+		Reader:            strings.NewReader(executableFunctionsConfig),
+		ContainerFilePath: executableFunctionsPath,
+		FileMode:          certFileMode,
+	}}
+
+	for _, info := range list {
+		if info.IsDir() {
+			continue
+		}
+
+		data, err := readFile(fs, path.Join(dir, info.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("can't read executable udf %s: %w", info.Name(), err)
+		}
+
+		file := testcontainers.ContainerFile{
+			Reader:            bytes.NewReader(data),
+			ContainerFilePath: path.Join(userScriptsDir, info.Name()),
+			FileMode:          userScriptFileMode,
+		}
+
+		if strings.EqualFold(path.Ext(info.Name()), ".xml") {
+			file.ContainerFilePath = path.Join(executableFunctionsDir, info.Name())
+			file.FileMode = certFileMode
+		}
+
+		files = append(files, file)
+	}
+
+	return func(req *testcontainers.GenericContainerRequest) error {
+		req.Files = append(req.Files, files...)
+
+		return nil
+	}, nil
+}
+
+const executableFunctionsConfig = "<clickhouse>\n" +
+	"    <user_defined_executable_functions_config>" + executableFunctionsDir + "/*.xml" +
+	"</user_defined_executable_functions_config>\n" +
+	"</clickhouse>\n"
@@ -0,0 +1,167 @@
+package groclick
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestRewriteFunctions(t *testing.T) {
+	mapping := map[string]string{"plus_one": "db_plus_one"}
+
+	cases := map[string]string{
+		"CREATE FUNCTION plus_one AS (x) -> x + 1":           "CREATE FUNCTION `db_plus_one` AS (x) -> x + 1",
+		"CREATE FUNCTION IF NOT EXISTS plus_one AS (x) -> x": "CREATE FUNCTION IF NOT EXISTS `db_plus_one` AS (x) -> x",
+		"DROP FUNCTION IF EXISTS `plus_one`":                 "DROP FUNCTION IF EXISTS `db_plus_one`",
+		"SELECT plus_one(id), plus_one FROM t":               "SELECT `db_plus_one`(id), plus_one FROM t",
+		"SELECT 'plus_one(1)', t.plus_one(1) FROM t":         "SELECT 'plus_one(1)', t.plus_one(1) FROM t",
+	}
+
+	for statement, exp := range cases {
+		assert.Equal(t, exp, RewriteFunctions(statement, mapping), statement)
+	}
+
+	assert.Equal(t, "SELECT plus_one(1)", RewriteFunctions("SELECT plus_one(1)", nil))
+}
+
+func TestDiscoverFunctions(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/migrations/001_functions.sql", []byte(
+		"CREATE FUNCTION plus_one AS (x) -> x + 1;\n"+
+			"CREATE OR REPLACE FUNCTION IF NOT EXISTS `twice` AS (x) -> x * 2;\n"+
+			"DROP FUNCTION IF EXISTS legacy;\n"+
+			"CREATE TABLE t (id UInt64) ENGINE = Memory;",
+	), 0o644))
+
+	t.Run("should be able to find created functions", func(t *testing.T) {
+		cfg := config{fs: fs}
+		WithFunctionNamespacing("custom", "twice")(&cfg)
+
+		require.NoError(t, discoverFunctions(&cfg, "/migrations"))
+		assert.Equal(t, []string{"custom", "plus_one", "twice"}, cfg.functions)
+	})
+
+	t.Run("should be able to skip without namespacing", func(t *testing.T) {
+		cfg := config{fs: fs}
+
+		require.NoError(t, discoverFunctions(&cfg, "/migrations"))
+		assert.Empty(t, cfg.functions)
+	})
+
+	t.Run("should be able failed when can't read migrations", func(t *testing.T) {
+		cfg := config{fs: fs, functionNamespacing: true}
+
+		require.Error(t, discoverFunctions(&cfg, "/unknown"))
+	})
+}
+
+func TestForker_Functions(t *testing.T) {
+	root := NewMockConn(t)
+	conn := NewMockConn(t)
+	exp := Functions{"plus_one": "groclick_run_1_plus_one"}
+
+	fork := newForker(t.Context(), root, isolationDSN, "", config{
+		runID:     "run",
+		functions: []string{"plus_one"},
+		migrator: func(ctx context.Context, cfg MigratorConfig) error {
+			assert.Equal(t, exp, cfg.Functions)
+			return nil
+		},
+		connConstructor: func(opt *clickhouse.Options) (driver.Conn, error) {
+			return conn, nil
+		},
+	})
+
+	root.EXPECT().Exec(mock.Anything, "CREATE DATABASE `groclick_run_1`").Return(nil).Once()
+	conn.EXPECT().Ping(mock.Anything).Return(nil)
+
+	dbs := fork.fork(t, "", nil, nil)
+	assert.Equal(t, exp, fork.functionsOf(dbs))
+	assert.Equal(t, "groclick_run_1_plus_one", fork.functionsOf(dbs).Name("plus_one"))
+	assert.Equal(t, "unknown", fork.functionsOf(dbs).Name("unknown"))
+
+	t.Run("should be able to drop namespaced functions", func(t *testing.T) {
+		root.EXPECT().Exec(mock.Anything, "DROP DATABASE `groclick_run_1`").Return(nil).Once()
+		root.EXPECT().Exec(mock.Anything, "DROP FUNCTION IF EXISTS `groclick_run_1_plus_one`").Return(nil).Once()
+
+		require.NoError(t, fork.drop(t.Context(), "groclick_run_1"))
+	})
+}
+
+func TestForker_FunctionsOfLogicalDatabases(t *testing.T) {
+	root := NewMockConn(t)
+	conn := NewMockConn(t)
+
+	fork := newForker(t.Context(), root, isolationDSN, "", config{
+		runID:     "run",
+		functions: []string{"plus_one"},
+		databases: []LogicalDatabase{
+			{Name: "raw", Migrator: func(ctx context.Context, cfg MigratorConfig) error { return nil }},
+			{Name: "agg", Migrator: func(ctx context.Context, cfg MigratorConfig) error { return nil }},
+		},
+		connConstructor: func(opt *clickhouse.Options) (driver.Conn, error) {
+			return conn, nil
+		},
+	})
+
+	root.EXPECT().Exec(mock.Anything, "CREATE DATABASE `groclick_raw_run_1`").Return(nil).Once()
+	root.EXPECT().Exec(mock.Anything, "CREATE DATABASE `groclick_agg_run_2`").Return(nil).Once()
+	conn.EXPECT().Ping(mock.Anything).Return(nil)
+
+	_ = fork.fork(t, "", nil, nil)
+
+	t.Run("should be able to drop functions only with primary database", func(t *testing.T) {
+		root.EXPECT().Exec(mock.Anything, "DROP DATABASE `groclick_agg_run_2`").Return(nil).Once()
+		root.EXPECT().Exec(mock.Anything, "DROP DATABASE `groclick_raw_run_1`").Return(nil).Once()
+		root.EXPECT().Exec(mock.Anything, "DROP FUNCTION IF EXISTS `groclick_raw_run_1_plus_one`").Return(nil).Once()
+
+		require.NoError(t, fork.dropRemaining(t.Context()))
+		assert.Empty(t, fork.remaining())
+	})
+}
+
+func TestExecutableUDFs(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/udfs/echo.xml", []byte("<functions/>"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/udfs/echo.py", []byte("print(1)"), 0o644))
+	require.NoError(t, fs.MkdirAll("/udfs/nested", 0o755))
+
+	t.Run("should be able to ship scripts and definitions", func(t *testing.T) {
+		customize, err := executableUDFs(fs, "/udfs")
+		require.NoError(t, err)
+
+		req := testcontainers.GenericContainerRequest{}
+		require.NoError(t, customize(&req))
+		require.Len(t, req.Files, 3)
+
+		assert.Equal(t, executableFunctionsPath, req.Files[0].ContainerFilePath)
+		data, err := io.ReadAll(req.Files[0].Reader)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), executableFunctionsDir+"/*.xml")
+
+		assert.Equal(t, userScriptsDir+"/echo.py", req.Files[1].ContainerFilePath)
+		assert.Equal(t, int64(userScriptFileMode), req.Files[1].FileMode)
+		assert.Equal(t, executableFunctionsDir+"/echo.xml", req.Files[2].ContainerFilePath)
+	})
+
+	t.Run("should be able failed when can't read dir", func(t *testing.T) {
+		_, err := executableUDFs(fs, "/unknown")
+		require.Error(t, err)
+	})
+
+	t.Run("should be able to reject hosted mode", func(t *testing.T) {
+		_, err := hostedBootstrapper[struct{}](config{
+			hostedDBNamespace: "ns",
+			executableUDFs:    "/udfs",
+		})(t.Context())
+		require.ErrorIs(t, err, ErrExecutableUDFRequiresContainer)
+	})
+}
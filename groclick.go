@@ -1,12 +1,19 @@
 package groclick
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
-	"sync/atomic"
+	"runtime"
+	"testing"
+	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/docker/go-connections/nat"
 	"github.com/godepo/groat/integration"
 	"github.com/godepo/groat/pkg/ctxgroup"
 	"github.com/godepo/groclick/internal/pkg/containersync"
@@ -14,15 +21,40 @@ import (
 
 	clickConn "github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/testcontainers/testcontainers-go"
+	tcexec "github.com/testcontainers/testcontainers-go/exec"
 	"github.com/testcontainers/testcontainers-go/modules/clickhouse"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type (
+	// ClickhouseContainer is container started by runner. Optional capabilities, like port endpoints, are
+	// probed with type assertions, so container without them fails only with options requiring them.
 	ClickhouseContainer interface {
 		ConnectionString(ctx context.Context, args ...string) (string, error)
 		Terminate(ctx context.Context, opts ...testcontainers.TerminateOption) error
 	}
 
+	// optional capabilities of ClickhouseContainer, testcontainers clickhouse module provides all of them.
+	containerEndpoints interface {
+		PortEndpoint(ctx context.Context, port nat.Port, proto string) (string, error)
+	}
+
+	containerLogsReader interface {
+		Logs(ctx context.Context) (io.ReadCloser, error)
+	}
+
+	containerExecutor interface {
+		Exec(ctx context.Context, cmd []string, options ...tcexec.ProcessOption) (int, io.Reader, error)
+	}
+
+	capableContainer interface {
+		ClickhouseContainer
+		containerEndpoints
+		containerLogsReader
+		containerExecutor
+	}
+
 	Connect struct {
 		driver.Conn
 	}
@@ -34,24 +66,26 @@ type (
 	) (ClickhouseContainer, error)
 
 	Container[T any] struct {
-		forks                *atomic.Int32
 		click                ClickhouseContainer
 		ctx                  context.Context
-		migrator             Migrator
-		migrationsPath       string
 		connString           string
 		injectLabel          string
 		opts                 *clickConn.Options
 		root                 driver.Conn
-		connConstructor      func(opt *clickConn.Options) (driver.Conn, error)
 		injectLabelForConfig string
 		injectLabelForDSN    string
+		injectLabelForDBs    string
+		isolation            isolator
+		logs                 *containerLogs
+		companions           *companions
+		fork                 *forker
+		injectLabelForDicts  string
+		injectLabelForFuncs  string
 	}
 	config struct {
 		user                 string
 		password             string
 		containerImage       string
-		imageEnvValue        string
 		migrator             Migrator
 		fs                   afero.Fs
 		migrationsPath       string
@@ -62,6 +96,68 @@ type (
 		hostedDSN            string
 		injectLabelForConfig string
 		injectLabelForDSN    string
+		isolation            Isolation
+		poolSize             int
+		runID                string
+		sweepTTL             time.Duration
+		sweepDryRun          bool
+		cluster              string
+		clusterDDLTimeout    time.Duration
+		tlsCAFile            string
+		tlsCertFile          string
+		tlsKeyFile           string
+		tlsServerName        string
+		containerTLS         bool
+		containerCA          []byte
+		configFile           string
+		startupTimeout       time.Duration
+		startupDeadline      time.Time
+		readinessProbes      []ReadinessProbe
+		readinessBackoff     time.Duration
+		readinessMaxBackoff  time.Duration
+		logTail              int
+		containerLogs        LogLevel
+		settings             clickConn.Settings
+		testSettings         func(t *testing.T) clickConn.Settings
+		logger               *slog.Logger
+		tracerProvider       trace.TracerProvider
+		timingReport         io.Writer
+		timingReportFile     string
+		timings              *timings
+		lint                 *LintConfig
+		databaseRewrite      []string
+		databases            []LogicalDatabase
+		injectLabelForDBs    string
+		minioImage           string
+		injectLabelForS3     string
+		companionRunner      companionRunner
+		companionNetwork     companionNetwork
+		redpandaImage        string
+		kafkaTopics          []string
+		injectLabelForKafka  string
+		companions           *companions
+		dictionaryStandIns   map[string]DictionaryStandIn
+		dictionaryStubHost   string
+		dictionaryStub       *dictionaryStub
+		dockerGateway        func(ctx context.Context) (string, error)
+		injectLabelForDicts  string
+		functionNamespacing  bool
+		functions            []string
+		executableUDFs       string
+		injectLabelForFuncs  string
+		maxConcurrentForks   int
+		shutdownTimeout      time.Duration
+		terminateRetries     int
+		terminateBackoff     time.Duration
+		shutdownExport       string
+		shutdownHandler      func(err error)
+		withoutRyuk          bool
+		orphanSweeper        *orphanSweeper
+		memoryLimit          int
+		cpuLimit             float64
+		noFileLimit          int
+		shmSize              int
+		maxServerMemoryUsage int
 	}
 
 	DB interface {
@@ -69,12 +165,18 @@ type (
 	}
 
 	MigratorConfig struct {
-		DBName   string
-		Path     string
-		DB       DB
-		UserName string
-		Password string
-		Config   *clickConn.Options
+		DBName    string
+		Path      string
+		DB        DB
+		UserName  string
+		Password  string
+		Config    *clickConn.Options
+		Cluster   string
+		Logger    *slog.Logger
+		Databases map[string]string
+		Variables map[string]string
+		StandIns  DictionaryStandIns
+		Functions Functions
 	}
 
 	Migrator func(ctx context.Context, migratorConfig MigratorConfig) error
@@ -82,6 +184,11 @@ type (
 	Option func(*config)
 )
 
+// ErrUnsupportedContainer is returned when ClickhouseContainer lacks capability required by enabled option.
+var ErrUnsupportedContainer = errors.New("clickhouse container doesn't support")
+
+var _ capableContainer = (*clickhouse.ClickHouseContainer)(nil)
+
 func WithContainerImage(image string) Option {
 	return func(c *config) {
 		c.containerImage = image
@@ -136,18 +243,58 @@ func WithInjectLabelForDSN(label string) Option {
 	}
 }
 
+func WithHostedDSN(dsn string) Option {
+	return func(c *config) {
+		c.hostedDSN = dsn
+	}
+}
+
 func New[T any](options ...Option) integration.Bootstrap[T] {
-	cfg := config{
+	cfg := defaultConfig()
+
+	if _, err := resolveConfig(&cfg, os.LookupEnv, options...); err != nil {
+		return func(ctx context.Context) (integration.Injector[T], error) {
+			return nil, fmt.Errorf("can't resolve config: %w", err)
+		}
+	}
+
+	if cfg.hostedDSN != "" {
+		return hostedBootstrapper[T](cfg)
+	}
+
+	return bootstrapper[T](cfg)
+}
+
+func defaultConfig() config {
+	return config{
 		user:                 "",
 		password:             "",
 		containerImage:       "clickhouse/clickhouse-server:23.3.8.21-alpine",
-		imageEnvValue:        "GROAT_I9N_CH_IMAGE",
 		injectLabel:          "clickhouse",
 		migrationsPath:       "../sql/migrations",
 		fs:                   afero.NewOsFs(),
 		connConstructor:      clickConn.Open,
 		injectLabelForConfig: "clickhouse.config",
 		injectLabelForDSN:    "clickhouse.dsn",
+		injectLabelForDBs:    "clickhouse.databases",
+		injectLabelForS3:     "clickhouse.s3",
+		injectLabelForKafka:  "clickhouse.kafka",
+		injectLabelForDicts:  "clickhouse.dictionaries",
+		injectLabelForFuncs:  "clickhouse.functions",
+		companionRunner:      defaultCompanionRunner,
+		companionNetwork:     defaultCompanionNetwork,
+		dockerGateway:        dockerGatewayIP,
+		poolSize:             runtime.GOMAXPROCS(0),
+		runID:                newRunID(),
+		startupTimeout:       defaultStartupTimeout,
+		readinessProbes:      []ReadinessProbe{PingProbe(), SystemTablesProbe()},
+		readinessBackoff:     defaultReadinessBackoff,
+		readinessMaxBackoff:  defaultReadinessMaxBackoff,
+		logTail:              defaultLogTail,
+		shutdownTimeout:      defaultShutdownTimeout,
+		terminateRetries:     defaultTerminateRetries,
+		terminateBackoff:     defaultTerminateBackoff,
+		logger:               slog.Default(),
 		runner: func(
 			ctx context.Context,
 			img string, opts ...testcontainers.ContainerCustomizer,
@@ -155,37 +302,18 @@ func New[T any](options ...Option) integration.Bootstrap[T] {
 			return clickhouse.Run(ctx, img, opts...)
 		},
 	}
-
-	for _, op := range options {
-		op(&cfg)
-	}
-
-	if env := os.Getenv(cfg.imageEnvValue); env != "" {
-		cfg.containerImage = env
-	}
-
-	if env := os.Getenv("GROAT_I9N_CH_DSN"); env != "" {
-		cfg.hostedDSN = env
-
-		return hostedBootstrapper[T](cfg)
-	}
-
-	return bootstrapper[T](cfg)
 }
 
 func bootstrapper[T any](cfg config) integration.Bootstrap[T] {
 	return func(ctx context.Context) (integration.Injector[T], error) {
-		if cfg.migrator == nil {
-			mig, err := PlainMigrator(cfg.fs, cfg.migrationsPath)
-			if err != nil {
-				return nil, err
-			}
-			cfg.migrator = mig
+		if err := prepareMigrators(&cfg); err != nil {
+			return nil, err
 		}
 
-		clickhouseContainer, err := cfg.runner(
-			ctx,
-			cfg.containerImage,
+		cfg.timings = newTimings(cfg)
+		cfg.timings.reportOnDone(ctx, cfg)
+
+		opts := []testcontainers.ContainerCustomizer{
 			clickhouse.WithUsername(cfg.user),
 			clickhouse.WithPassword(cfg.password),
 			testcontainers.CustomizeRequest(testcontainers.GenericContainerRequest{
@@ -194,20 +322,115 @@ func bootstrapper[T any](cfg config) integration.Bootstrap[T] {
 					Env:   map[string]string{"PGDATA": "/tmpfs"},
 				},
 			}),
-		)
+		}
+
+		if cfg.limitsResources() {
+			opts = append(opts, cfg.resourcesCustomizer())
+		}
+
+		if cfg.containerTLS {
+			selfSigned, err := newSelfSignedTLS(time.Now())
+			if err != nil {
+				return nil, err
+			}
+
+			cfg.containerCA = selfSigned.caPEM
+			opts = append(opts, selfSigned.customizer())
+		}
+
+		var startedAt time.Time
+		if cfg.timings != nil {
+			opts = append(opts, cfg.timings.containerHooks(&startedAt))
+		}
+
+		if err := reapAtBootstrap(ctx, cfg); err != nil {
+			return nil, err
+		}
+
+		if labels := cfg.sessionLabels(); labels != nil {
+			opts = append(opts, testcontainers.WithLabels(labels))
+		}
+
+		companion, err := startCompanions(ctx, cfg)
+		if err != nil {
+			return nil, errors.Join(err, companion.shutdown(context.Background())) //nolint:contextcheck
+		}
+		opts = append(opts, companion.customizers()...)
+
+		if cfg.executableUDFs != "" {
+			udfs, err := executableUDFs(cfg.fs, cfg.executableUDFs)
+			if err != nil {
+				return nil, err
+			}
+
+			opts = append(opts, udfs)
+		}
+
+		if cfg.usesDictionaryStub() {
+			host := cmp.Or(cfg.dictionaryStubHost, defaultDictionaryStubHost)
+
+			cfg.dictionaryStub, err = startContainerDictionaryStub(ctx, cfg.dockerGateway, host)
+			if err != nil {
+				return nil, err
+			}
+
+			opts = append(opts, hostGateway(host))
+		}
+
+		var logs *containerLogs
+		if cfg.containerLogs != LogLevelNone {
+			logs = newContainerLogs(cfg.containerLogs)
+			opts = append(opts, logs.customizer())
+		}
+
+		startedAt = time.Now()
+		if cfg.startupTimeout > 0 {
+			cfg.startupDeadline = startedAt.Add(cfg.startupTimeout)
+		}
+
+		spanCtx, span := cfg.tracer().Start(ctx, "groclick.container.start", trace.WithAttributes(
+			attribute.String("container.image", cfg.containerImage),
+		))
+		runCtx, started := startupContext(spanCtx, cfg.startupTimeout)
+		clickhouseContainer, err := cfg.runner(runCtx, cfg.containerImage, opts...)
+		started()
+		endSpan(span, err)
 
 		if err != nil {
+			if cause := context.Cause(runCtx); errors.Is(cause, ErrStartupTimeout) {
+				err = fmt.Errorf("%w: %w", cause, err)
+			}
+
+			cfg.log().Error("clickhouse container failed to start",
+				slog.String("image", cfg.containerImage),
+				slog.Duration("duration", time.Since(startedAt)),
+				slog.Any("error", err),
+			)
+
+			err = errors.Join(err, companion.shutdown(context.Background())) //nolint:contextcheck
+
 			return nil, fmt.Errorf("postgres container failed to run: %w", err)
 		}
 
+		cfg.log().Info("clickhouse container started",
+			slog.String("image", cfg.containerImage),
+			slog.Duration("duration", time.Since(startedAt)),
+		)
+
 		ctxgroup.IncAt(ctx)
 
-		go containersync.Terminator(ctx, clickhouseContainer.Terminate)()
+		stop := newShutdown(cfg, clickhouseContainer, companion.terminateWith(clickhouseContainer.Terminate), logs)
+
+		go containersync.Terminator(ctx, cfg.log(), stop.run)()
+
+		cfg.companions = companion
 
 		container, err := newContainer[T](ctx, clickhouseContainer, cfg)
 		if err != nil {
-			return nil, err
+			return nil, withLogTail(ctx, clickhouseContainer, cfg.logTail, err)
 		}
+		container.logs = logs
+		stop.attach(container.fork)
 
 		return container.Injector, nil
 	}
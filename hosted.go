@@ -4,23 +4,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
 	"github.com/godepo/groat/integration"
 	"github.com/godepo/groat/pkg/generics"
-	"github.com/stretchr/testify/require"
 )
 
 var ErrRequireNamespacePrefixForHostedDB = errors.New("hosted db requires namespace prefix")
 
 type hostedClickhouse[T any] struct {
-	root  driver.Conn
-	cfg   config
-	forks *atomic.Int32
-	ctx   context.Context
+	root      driver.Conn
+	cfg       config
+	fork      *forker
+	isolation isolator
 }
 
 func hostedBootstrapper[T any](cfg config) integration.Bootstrap[T] {
@@ -29,80 +28,92 @@ func hostedBootstrapper[T any](cfg config) integration.Bootstrap[T] {
 			return nil, ErrRequireNamespacePrefixForHostedDB
 		}
 
-		if cfg.migrator == nil {
-			mig, err := PlainMigrator(cfg.fs, cfg.migrationsPath)
+		if cfg.minioImage != "" || cfg.redpandaImage != "" {
+			return nil, ErrCompanionRequiresContainer
+		}
+
+		if cfg.executableUDFs != "" {
+			return nil, ErrExecutableUDFRequiresContainer
+		}
+
+		if cfg.usesDictionaryStub() && cfg.dictionaryStubHost == "" {
+			return nil, ErrDictionaryStubHostRequired
+		}
+
+		if err := prepareMigrators(&cfg); err != nil {
+			return nil, err
+		}
+
+		if cfg.usesDictionaryStub() {
+			// remote server reaches stub by host set by user, so it listens on every interface.
+			stub, err := startDictionaryStub(ctx, "", cfg.dictionaryStubHost)
 			if err != nil {
 				return nil, err
 			}
-			cfg.migrator = mig
+			cfg.dictionaryStub = stub
 		}
 
-		local := &hostedClickhouse[T]{
-			cfg:   cfg,
-			forks: &atomic.Int32{},
-			ctx:   ctx,
-		}
+		cfg.timings = newTimings(cfg)
+		cfg.timings.reportOnDone(ctx, cfg)
 
 		opts, err := clickhouse.ParseDSN(cfg.hostedDSN)
 		if err != nil {
 			return nil, fmt.Errorf("can't parse hosted dsn: %w", err)
 		}
 
+		tlsCfg, err := cfg.tlsConfig(nil)
+		if err != nil {
+			return nil, err
+		}
+		applyTLS(opts, tlsCfg)
+
+		connectedAt := time.Now()
+		_, span := cfg.tracer().Start(ctx, "groclick.connect")
 		conn, err := cfg.connConstructor(opts)
+		endSpan(span, err)
+		cfg.timings.since(PhaseConnect, connectedAt)
+
 		if err != nil {
 			return nil, fmt.Errorf("can't create connection to hosted db: %w", err)
 		}
 
-		local.root = conn
+		if err := sweepAtBootstrap(ctx, conn, cfg); err != nil {
+			return nil, fmt.Errorf("can't sweep orphaned databases: %w", err)
+		}
+
+		local := newHostedClickhouse[T](ctx, conn, cfg)
+		local.fork.tls = tlsCfg
 
 		return local.Injector, nil
 	}
 }
 
+func newHostedClickhouse[T any](ctx context.Context, root driver.Conn, cfg config) *hostedClickhouse[T] {
+	fork := newForker(ctx, root, cfg.hostedDSN, cfg.hostedDBNamespace, cfg)
+	fork.stamp = true
+	fork.cluster = cfg.cluster
+	fork.ddlTimeout = cfg.clusterDDLTimeout
+
+	return &hostedClickhouse[T]{
+		root:      root,
+		cfg:       cfg,
+		fork:      fork,
+		isolation: newIsolator(cfg, fork, true),
+	}
+}
+
 func (c *hostedClickhouse[T]) Injector(t *testing.T, to T) T {
 	t.Helper()
 
-	cfg, err := clickhouse.ParseDSN(c.cfg.hostedDSN)
-	require.NoError(t, err)
-
-	cfg.Auth.Database = fmt.Sprintf("%s_%d", cfg.Auth.Database, c.forks.Add(1))
-
-	dbName := c.cfg.hostedDBNamespace + cfg.Auth.Database
-	err = c.root.Exec(
-		c.ctx,
-		"CREATE DATABASE "+dbName,
-	)
-	require.NoError(t, err,
-		"can't created database=%s for user %s",
-		dbName, cfg.Auth.Username,
-	)
+	dbs := c.isolation.lease(t)
+	db := dbs.primary()
 
-	t.Cleanup(func() {
-		err := c.root.Exec(c.ctx, "DROP DATABASE "+dbName)
-		if err != nil {
-			t.Logf("can't cleanup database %s: %v", dbName, err)
-		}
-	})
-
-	cfg.Auth.Database = dbName
-
-	con, err := c.cfg.connConstructor(cfg)
-	require.NoError(t, err)
-
-	require.NoError(t, con.Ping(c.ctx))
-
-	err = c.cfg.migrator(c.ctx, MigratorConfig{
-		Config:   cfg,
-		DB:       con,
-		DBName:   cfg.Auth.Database,
-		Path:     c.cfg.migrationsPath,
-		UserName: cfg.Auth.Username,
-		Password: cfg.Auth.Password,
-	})
-	require.NoError(t, err)
-	res := generics.Injector(t, &Connect{con}, to, c.cfg.injectLabel)
-	res = generics.Injector(t, cfg, res, c.cfg.injectLabelForConfig)
+	res := generics.Injector(t, &Connect{db.conn}, to, c.cfg.injectLabel)
+	res = generics.Injector(t, db.cfg, res, c.cfg.injectLabelForConfig)
 	res = generics.Injector(t, c.cfg.hostedDSN, res, c.cfg.injectLabelForDSN)
+	res = injectDatabases(t, res, dbs, c.cfg.injectLabel, c.cfg.injectLabelForDBs)
+	res = injectDictionaries(t, res, dbs, c.fork, c.cfg.injectLabelForDicts)
+	res = generics.Injector(t, c.fork.functionsOf(dbs), res, c.cfg.injectLabelForFuncs)
 
 	return res
 }
@@ -3,7 +3,7 @@ package groclick
 import (
 	"context"
 	"errors"
-	"sync/atomic"
+	"strings"
 	"testing"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
@@ -101,27 +101,26 @@ func TestHostedClickhouse_Injector(t *testing.T) {
 		root := NewMockConn(t)
 		conn := NewMockConn(t)
 
-		hostedClick := hostedClickhouse[Deps]{
-			root: root,
-			cfg: config{
-				hostedDSN:         envHost,
-				hostedDBNamespace: uuid.NewString(),
-				connConstructor: func(opt *clickhouse.Options) (driver.Conn, error) {
-					return conn, nil
-				},
-				migrator: func(ctx context.Context, migratorConfig MigratorConfig) error {
-					return nil
-				},
+		hostedClick := newHostedClickhouse[Deps](t.Context(), root, config{
+			hostedDSN:         envHost,
+			hostedDBNamespace: uuid.NewString(),
+			runID:             "run",
+			connConstructor: func(opt *clickhouse.Options) (driver.Conn, error) {
+				return conn, nil
 			},
-			forks: &atomic.Int32{},
-			ctx:   t.Context(),
-		}
+			migrator: func(ctx context.Context, migratorConfig MigratorConfig) error {
+				return nil
+			},
+		})
 		var deps Deps
+		dbName := "`" + hostedClick.cfg.hostedDBNamespace + "_" + sanitizeIdentifier(t.Name()) + "_run_1`"
 
 		root.EXPECT().
 			Exec(
 				mock.Anything,
-				"CREATE DATABASE "+hostedClick.cfg.hostedDBNamespace+"_1",
+				mock.MatchedBy(func(query string) bool {
+					return strings.HasPrefix(query, "CREATE DATABASE "+dbName+" COMMENT 'groclick:run=run;host=")
+				}),
 			).Return(nil)
 
 		conn.EXPECT().Ping(mock.Anything).Return(nil)
@@ -129,10 +128,10 @@ func TestHostedClickhouse_Injector(t *testing.T) {
 		root.EXPECT().
 			Exec(
 				mock.Anything,
-				"DROP DATABASE "+hostedClick.cfg.hostedDBNamespace+"_1",
+				"DROP DATABASE "+dbName,
 			).Return(nil)
 
-		t.Log("DROP DATABASE " + hostedClick.cfg.hostedDBNamespace + "_1")
+		t.Log("DROP DATABASE " + dbName)
 		t.Log("WTF?")
 
 		deps = hostedClick.Injector(t, deps)
@@ -145,27 +144,26 @@ func TestHostedClickhouse_Injector(t *testing.T) {
 			root := NewMockConn(t)
 			conn := NewMockConn(t)
 
-			hostedClick := hostedClickhouse[Deps]{
-				root: root,
-				cfg: config{
-					hostedDSN:         envHost,
-					hostedDBNamespace: uuid.NewString(),
-					connConstructor: func(opt *clickhouse.Options) (driver.Conn, error) {
-						return conn, nil
-					},
-					migrator: func(ctx context.Context, migratorConfig MigratorConfig) error {
-						return nil
-					},
+			hostedClick := newHostedClickhouse[Deps](t.Context(), root, config{
+				hostedDSN:         envHost,
+				hostedDBNamespace: uuid.NewString(),
+				runID:             "run",
+				connConstructor: func(opt *clickhouse.Options) (driver.Conn, error) {
+					return conn, nil
 				},
-				forks: &atomic.Int32{},
-				ctx:   t.Context(),
-			}
+				migrator: func(ctx context.Context, migratorConfig MigratorConfig) error {
+					return nil
+				},
+			})
 			var deps Deps
+			dbName := "`" + hostedClick.cfg.hostedDBNamespace + "_" + sanitizeIdentifier(t.Name()) + "_run_1`"
 
 			root.EXPECT().
 				Exec(
 					mock.Anything,
-					"CREATE DATABASE "+hostedClick.cfg.hostedDBNamespace+"_1",
+					mock.MatchedBy(func(query string) bool {
+						return strings.HasPrefix(query, "CREATE DATABASE "+dbName+" COMMENT 'groclick:run=run;host=")
+					}),
 				).Return(nil)
 
 			conn.EXPECT().Ping(mock.Anything).Return(nil)
@@ -173,7 +171,7 @@ func TestHostedClickhouse_Injector(t *testing.T) {
 			root.EXPECT().
 				Exec(
 					mock.Anything,
-					"DROP DATABASE "+hostedClick.cfg.hostedDBNamespace+"_1",
+					"DROP DATABASE "+dbName,
 				).Return(errors.New(uuid.NewString()))
 
 			deps = hostedClick.Injector(t, deps)
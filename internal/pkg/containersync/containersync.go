@@ -2,13 +2,18 @@ package containersync
 
 import (
 	"context"
-	"log"
+	"log/slog"
+	"time"
 
 	"github.com/godepo/groat/pkg/ctxgroup"
 	"github.com/testcontainers/testcontainers-go"
 )
 
-func Terminator(ctx context.Context, terminate func(context.Context, ...testcontainers.TerminateOption) error) func() {
+func Terminator(
+	ctx context.Context,
+	logger *slog.Logger,
+	terminate func(context.Context, ...testcontainers.TerminateOption) error,
+) func() {
 	return func() {
 		<-ctx.Done()
 
@@ -16,9 +21,18 @@ func Terminator(ctx context.Context, terminate func(context.Context, ...testcont
 			ctxgroup.DoneFrom(ctx)
 		}()
 
+		startedAt := time.Now()
+
 		err := terminate(context.Background()) //nolint:contextcheck
 		if err != nil {
-			log.Printf("---[GOAT]: error terminating clickhouse container: %v\n", err)
+			logger.Error("error terminating clickhouse container",
+				slog.Duration("duration", time.Since(startedAt)),
+				slog.Any("error", err),
+			)
+
+			return
 		}
+
+		logger.Info("clickhouse container terminated", slog.Duration("duration", time.Since(startedAt)))
 	}
 }
@@ -3,6 +3,7 @@ package containersync
 import (
 	"context"
 	"errors"
+	"log/slog"
 	"sync"
 	"testing"
 
@@ -46,7 +47,7 @@ func newTerminatorCase(t *testing.T) *groat.Case[Deps, State, func()] {
 		deps.WG.Wait()
 	})
 	tcs.Go()
-	tcs.SUT = Terminator(tcs.Deps.ctx, func(ctx context.Context, _ ...testcontainers.TerminateOption) error {
+	tcs.SUT = Terminator(tcs.Deps.ctx, slog.New(slog.DiscardHandler), func(ctx context.Context, _ ...testcontainers.TerminateOption) error {
 		err := tcs.State.handler(ctx)
 		tcs.Deps.WG.Done()
 		return err
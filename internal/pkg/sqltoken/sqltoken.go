@@ -0,0 +1,217 @@
+package sqltoken
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type Kind int
+
+const (
+	Whitespace Kind = iota
+	Comment
+	Word
+	QuotedIdentifier
+	String
+	Number
+	Punct
+)
+
+type Token struct {
+	Kind   Kind
+	Text   string
+	Offset int
+	Line   int
+}
+
+func Tokenize(sql string) []Token {
+	tokens := make([]Token, 0, len(sql)/4)
+	line := 1
+
+	for offset := 0; offset < len(sql); {
+		kind, size := next(sql[offset:])
+		text := sql[offset : offset+size]
+
+		tokens = append(tokens, Token{Kind: kind, Text: text, Offset: offset, Line: line})
+
+		line += strings.Count(text, "\n")
+		offset += size
+	}
+
+	return tokens
+}
+
+func Join(tokens []Token) string {
+	var builder strings.Builder
+
+	for _, token := range tokens {
+		builder.WriteString(token.Text)
+	}
+
+	return builder.String()
+}
+
+func Split(sql string) [][]Token {
+	var (
+		statements [][]Token
+		current    []Token
+	)
+
+	for _, token := range Tokenize(sql) {
+		if token.Kind == Punct && token.Text == ";" {
+			statements = appendStatement(statements, current)
+			current = nil
+
+			continue
+		}
+
+		current = append(current, token)
+	}
+
+	return appendStatement(statements, current)
+}
+
+func Significant(tokens []Token) []int {
+	res := make([]int, 0, len(tokens))
+
+	for i, token := range tokens {
+		if token.Kind != Whitespace && token.Kind != Comment {
+			res = append(res, i)
+		}
+	}
+
+	return res
+}
+
+func (t Token) Is(keywords ...string) bool {
+	if t.Kind != Word {
+		return false
+	}
+
+	for _, keyword := range keywords {
+		if strings.EqualFold(t.Text, keyword) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t Token) IsIdentifier() bool {
+	return t.Kind == Word || t.Kind == QuotedIdentifier
+}
+
+func (t Token) Value() string {
+	switch t.Kind {
+	case QuotedIdentifier, String:
+		return unquote(t.Text)
+	default:
+		return t.Text
+	}
+}
+
+func appendStatement(statements [][]Token, statement []Token) [][]Token {
+	if len(Significant(statement)) == 0 {
+		return statements
+	}
+
+	return append(statements, statement)
+}
+
+func next(sql string) (Kind, int) {
+	r, size := utf8.DecodeRuneInString(sql)
+
+	switch {
+	case unicode.IsSpace(r):
+		return Whitespace, scanWhile(sql, unicode.IsSpace)
+	case strings.HasPrefix(sql, "--"), r == '#':
+		return Comment, lineEnd(sql)
+	case strings.HasPrefix(sql, "/*"):
+		end := strings.Index(sql[2:], "*/")
+		if end < 0 {
+			return Comment, len(sql)
+		}
+
+		return Comment, end + 4
+	case r == '`' || r == '"':
+		return QuotedIdentifier, scanQuoted(sql, byte(r))
+	case r == '\'':
+		return String, scanQuoted(sql, '\'')
+	case unicode.IsDigit(r):
+		return Number, scanWhile(sql, isNumberRune)
+	case isWordRune(r):
+		return Word, scanWhile(sql, isWordRune)
+	default:
+		return Punct, size
+	}
+}
+
+func scanWhile(sql string, fn func(r rune) bool) int {
+	for i, r := range sql {
+		if !fn(r) {
+			return i
+		}
+	}
+
+	return len(sql)
+}
+
+func scanQuoted(sql string, quote byte) int {
+	for i := 1; i < len(sql); i++ {
+		switch sql[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+
+				continue
+			}
+
+			return i + 1
+		}
+	}
+
+	return len(sql)
+}
+
+func lineEnd(sql string) int {
+	if end := strings.IndexByte(sql, '\n'); end >= 0 {
+		return end
+	}
+
+	return len(sql)
+}
+
+func unquote(text string) string {
+	if len(text) < 2 {
+		return text
+	}
+
+	quote := text[0]
+	body := text[1 : len(text)-1]
+
+	var builder strings.Builder
+
+	for i := 0; i < len(body); i++ {
+		switch {
+		case body[i] == '\\' && i+1 < len(body):
+			i++
+		case body[i] == quote && i+1 < len(body) && body[i+1] == quote:
+			i++
+		}
+
+		builder.WriteByte(body[i])
+	}
+
+	return builder.String()
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isNumberRune(r rune) bool {
+	return r == '.' || r == '_' || unicode.IsDigit(r) || unicode.IsLetter(r)
+}
@@ -0,0 +1,56 @@
+package sqltoken
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenize(t *testing.T) {
+	t.Run("should be able to keep source text", func(t *testing.T) {
+		sql := "CREATE TABLE `db`.\"t\" (id UInt64 COMMENT 'it''s; ok') -- trailing; comment\n" +
+			"ENGINE = MergeTree /* block; */ ORDER BY id # hash\n"
+
+		assert.Equal(t, sql, Join(Tokenize(sql)))
+	})
+
+	t.Run("should be able to classify tokens", func(t *testing.T) {
+		tokens := Tokenize("SELECT `a``b`, 'x\\'y', 1.5 FROM t")
+		significant := Significant(tokens)
+		require.Len(t, significant, 8)
+
+		kinds := make([]Kind, 0, len(significant))
+		for _, i := range significant {
+			kinds = append(kinds, tokens[i].Kind)
+		}
+
+		assert.Equal(t, []Kind{Word, QuotedIdentifier, Punct, String, Punct, Number, Word, Word}, kinds)
+		assert.Equal(t, "a`b", tokens[significant[1]].Value())
+		assert.Equal(t, "x'y", tokens[significant[3]].Value())
+		assert.True(t, tokens[significant[0]].Is("select"))
+		assert.False(t, tokens[significant[1]].Is("a`b"))
+		assert.True(t, tokens[significant[1]].IsIdentifier())
+	})
+
+	t.Run("should be able to track lines", func(t *testing.T) {
+		tokens := Tokenize("SELECT 1;\n\nSELECT 2")
+		last := tokens[len(tokens)-1]
+
+		assert.Equal(t, 3, last.Line)
+	})
+
+	t.Run("should be able to scan unterminated tokens", func(t *testing.T) {
+		assert.Len(t, Tokenize("/* open"), 1)
+		assert.Len(t, Tokenize("'open"), 1)
+		assert.Equal(t, "'", Tokenize("'")[0].Value())
+	})
+}
+
+func TestSplit(t *testing.T) {
+	statements := Split("CREATE TABLE t (s String DEFAULT ';');\n -- only comment;\n;SELECT 1")
+
+	require.Len(t, statements, 2)
+	assert.Equal(t, "CREATE TABLE t (s String DEFAULT ';')", Join(statements[0]))
+	assert.Equal(t, "SELECT 1", Join(statements[1]))
+}
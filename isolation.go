@@ -0,0 +1,200 @@
+package groclick
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Isolation int
+
+const (
+	IsolationDatabasePerTest Isolation = iota
+	IsolationPooledTruncate
+	IsolationShared
+)
+
+type (
+	isolator interface {
+		lease(t *testing.T) forkedDatabases
+	}
+
+	perTestIsolation struct {
+		forker  *forker
+		cleanup bool
+	}
+
+	sharedIsolation struct {
+		forker  *forker
+		cleanup bool
+		mu      sync.Mutex
+		dbs     forkedDatabases
+	}
+
+	pooledIsolation struct {
+		forker  *forker
+		cleanup bool
+		slots   chan struct{}
+		idle    chan forkedDatabases
+	}
+)
+
+func WithIsolation(isolation Isolation) Option {
+	return func(c *config) {
+		c.isolation = isolation
+	}
+}
+
+func WithPoolSize(size int) Option {
+	return func(c *config) {
+		c.poolSize = size
+	}
+}
+
+func newIsolator(cfg config, forker *forker, cleanup bool) isolator {
+	switch cfg.isolation {
+	case IsolationShared:
+		if cleanup {
+			forker.dropRetained()
+		}
+
+		return &sharedIsolation{forker: forker, cleanup: cleanup}
+	case IsolationPooledTruncate:
+		if cleanup {
+			forker.dropRetained()
+		}
+
+		size := max(cfg.poolSize, 1)
+
+		return &pooledIsolation{
+			forker:  forker,
+			cleanup: cleanup,
+			slots:   make(chan struct{}, size),
+			idle:    make(chan forkedDatabases, size),
+		}
+	default:
+		return &perTestIsolation{forker: forker, cleanup: cleanup}
+	}
+}
+
+func (i *perTestIsolation) lease(t *testing.T) forkedDatabases {
+	t.Helper()
+
+	var created func(name string)
+	if i.cleanup {
+		created = i.forker.dropOnCleanup(t)
+	}
+
+	return i.forker.fork(t, t.Name(), i.forker.settingsOf(t), created)
+}
+
+func (i *sharedIsolation) lease(t *testing.T) forkedDatabases {
+	t.Helper()
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.dbs == nil {
+		var created func(name string)
+		if i.cleanup {
+			created = i.forker.retain
+		}
+
+		i.dbs = i.forker.fork(t, "shared", nil, created)
+	}
+
+	return i.forker.withTestSettings(t, i.dbs)
+}
+
+func (i *pooledIsolation) lease(t *testing.T) forkedDatabases {
+	t.Helper()
+
+	dbs := i.acquire(t)
+
+	t.Cleanup(func() {
+		i.put(t, dbs)
+	})
+
+	return i.forker.withTestSettings(t, dbs)
+}
+
+func (i *pooledIsolation) acquire(t *testing.T) forkedDatabases {
+	t.Helper()
+
+	select {
+	case db := <-i.idle:
+		return db
+	default:
+	}
+
+	select {
+	case db := <-i.idle:
+		return db
+	case i.slots <- struct{}{}:
+	case <-t.Context().Done():
+		require.NoError(t, t.Context().Err(), "can't lease database from pool")
+	}
+
+	forked := false
+	defer func() {
+		if !forked {
+			<-i.slots
+		}
+	}()
+
+	var created func(name string)
+	if i.cleanup {
+		created = i.forker.retain
+	}
+
+	dbs := i.forker.fork(t, "pool", nil, created)
+	forked = true
+
+	return dbs
+}
+
+func (i *pooledIsolation) put(t *testing.T, dbs forkedDatabases) {
+	var err error
+
+	for _, db := range dbs {
+		startedAt := time.Now()
+		ctx, span := i.forker.tracer.Start(i.forker.ctx, "groclick.database.truncate", trace.WithAttributes(
+			attribute.String("db.name", db.cfg.Auth.Database),
+		))
+		err = truncateDatabase(ctx, db.conn, db.cfg.Auth.Database, i.forker.cluster)
+		endSpan(span, err)
+		i.forker.timings.since(PhaseTruncate, startedAt)
+
+		if err != nil {
+			t.Logf("can't truncate database %s, it will be dropped: %v", db.cfg.Auth.Database, err)
+
+			break
+		}
+	}
+
+	if err == nil {
+		i.idle <- dbs
+
+		return
+	}
+
+	for _, db := range dbs {
+		_ = db.conn.Close()
+
+		if !i.cleanup {
+			continue
+		}
+
+		if err := i.forker.drop(i.forker.ctx, db.cfg.Auth.Database); err != nil {
+			t.Logf("can't cleanup database %s: %v", db.cfg.Auth.Database, err)
+		} else {
+			i.forker.release(db.cfg.Auth.Database)
+		}
+	}
+
+	<-i.slots
+}
@@ -0,0 +1,185 @@
+package groclick
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/godepo/groat/pkg/ctxgroup"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const isolationDSN = "http://localhost:8123/groclick?dial_timeout=200ms"
+
+func newIsolationForker(ctx context.Context, root, conn *MockConn) *forker {
+	return newForker(ctx, root, isolationDSN, "", config{
+		runID: "run",
+		connConstructor: func(opt *clickhouse.Options) (driver.Conn, error) {
+			return conn, nil
+		},
+		migrator: func(ctx context.Context, migratorConfig MigratorConfig) error {
+			return nil
+		},
+	})
+}
+
+func arrangeTruncate(conn *MockConn, db string, err error) {
+	conn.EXPECT().
+		Select(mock.Anything, mock.Anything, "SELECT name, engine FROM system.tables WHERE database = ?", []any{db}).
+		RunAndReturn(func(ctx context.Context, dest any, query string, args ...any) error {
+			*dest.(*[]systemTable) = []systemTable{
+				{Name: "groclick", Engine: "MergeTree"},
+				{Name: "groclick_mv", Engine: "MaterializedView"},
+			}
+			return err
+		})
+	if err != nil {
+		return
+	}
+	conn.EXPECT().Exec(mock.Anything, "TRUNCATE TABLE `"+db+"`.`groclick`").Return(nil)
+	conn.EXPECT().
+		Select(mock.Anything, mock.Anything, "SELECT name FROM system.dictionaries WHERE database = ?", []any{db}).
+		RunAndReturn(func(ctx context.Context, dest any, query string, args ...any) error {
+			*dest.(*[]systemDictionary) = []systemDictionary{{Name: "groclick_dict"}}
+			return nil
+		})
+	conn.EXPECT().Exec(mock.Anything, "SYSTEM RELOAD DICTIONARY `"+db+"`.`groclick_dict`").Return(nil)
+}
+
+func TestIsolation(t *testing.T) {
+	t.Run("should be able to share database", func(t *testing.T) {
+		root := NewMockConn(t)
+		conn := NewMockConn(t)
+
+		root.EXPECT().Exec(mock.Anything, "CREATE DATABASE `groclick_shared_run_1`").Return(nil).Once()
+		conn.EXPECT().Ping(mock.Anything).Return(nil).Once()
+
+		iso := newIsolator(config{isolation: IsolationShared}, newIsolationForker(t.Context(), root, conn), false)
+
+		first := iso.lease(t).primary()
+		second := iso.lease(t).primary()
+
+		assert.Same(t, first.conn, second.conn)
+		assert.Same(t, first.cfg, second.cfg)
+	})
+
+	t.Run("should be able to reuse truncated database from pool", func(t *testing.T) {
+		root := NewMockConn(t)
+		conn := NewMockConn(t)
+
+		root.EXPECT().Exec(mock.Anything, "CREATE DATABASE `groclick_pool_run_1`").Return(nil).Once()
+		conn.EXPECT().Ping(mock.Anything).Return(nil).Once()
+		arrangeTruncate(conn, "groclick_pool_run_1", nil)
+
+		iso := newIsolator(
+			config{isolation: IsolationPooledTruncate, poolSize: 1},
+			newIsolationForker(t.Context(), root, conn),
+			false,
+		)
+
+		t.Run("first lease", func(t *testing.T) {
+			cfg := iso.lease(t).primary().cfg
+			assert.Equal(t, "groclick_pool_run_1", cfg.Auth.Database)
+		})
+
+		t.Run("second lease", func(t *testing.T) {
+			cfg := iso.lease(t).primary().cfg
+			assert.Equal(t, "groclick_pool_run_1", cfg.Auth.Database)
+		})
+	})
+
+	t.Run("should be able to drop database which can't be truncated", func(t *testing.T) {
+		root := NewMockConn(t)
+		conn := NewMockConn(t)
+
+		root.EXPECT().Exec(mock.Anything, "CREATE DATABASE `groclick_pool_run_1`").Return(nil).Once()
+		root.EXPECT().Exec(mock.Anything, "DROP DATABASE `groclick_pool_run_1`").Return(nil).Once()
+		root.EXPECT().Exec(mock.Anything, "CREATE DATABASE `groclick_pool_run_2`").Return(nil).Once()
+		conn.EXPECT().Ping(mock.Anything).Return(nil).Twice()
+		conn.EXPECT().Close().Return(nil).Once()
+		arrangeTruncate(conn, "groclick_pool_run_1", errors.New(uuid.NewString()))
+		arrangeTruncate(conn, "groclick_pool_run_2", nil)
+
+		fork := newIsolationForker(t.Context(), root, conn)
+		iso := &pooledIsolation{
+			forker:  fork,
+			cleanup: true,
+			slots:   make(chan struct{}, 1),
+			idle:    make(chan forkedDatabases, 1),
+		}
+
+		t.Run("first lease", func(t *testing.T) {
+			cfg := iso.lease(t).primary().cfg
+			assert.Equal(t, "groclick_pool_run_1", cfg.Auth.Database)
+		})
+
+		t.Run("second lease", func(t *testing.T) {
+			cfg := iso.lease(t).primary().cfg
+			assert.Equal(t, "groclick_pool_run_2", cfg.Auth.Database)
+		})
+
+		assert.Equal(t, []string{"groclick_pool_run_2"}, fork.retained)
+	})
+
+	t.Run("should be able to drop retained databases when suite is done", func(t *testing.T) {
+		root := NewMockConn(t)
+		conn := NewMockConn(t)
+		wg := &sync.WaitGroup{}
+		ctx, cancel := context.WithCancel(ctxgroup.WithWaitGroup(t.Context(), wg))
+
+		root.EXPECT().Exec(mock.Anything, "CREATE DATABASE `groclick_shared_run_1`").Return(nil).Once()
+		root.EXPECT().Exec(mock.Anything, "DROP DATABASE `groclick_shared_run_1`").Return(errors.New(uuid.NewString())).Once()
+		conn.EXPECT().Ping(mock.Anything).Return(nil).Once()
+
+		fork := newIsolationForker(ctx, root, conn)
+		iso := newIsolator(config{isolation: IsolationShared}, fork, true)
+
+		_ = iso.lease(t)
+
+		cancel()
+		wg.Wait()
+
+		require.Empty(t, fork.retained)
+	})
+
+	t.Run("should be able to untrack dropped retained databases", func(t *testing.T) {
+		root := NewMockConn(t)
+		conn := NewMockConn(t)
+		wg := &sync.WaitGroup{}
+		ctx, cancel := context.WithCancel(ctxgroup.WithWaitGroup(t.Context(), wg))
+
+		root.EXPECT().Exec(mock.Anything, "CREATE DATABASE `groclick_shared_run_1`").Return(nil).Once()
+		root.EXPECT().Exec(mock.Anything, "DROP DATABASE `groclick_shared_run_1`").Return(nil).Once()
+		conn.EXPECT().Ping(mock.Anything).Return(nil).Once()
+
+		fork := newIsolationForker(ctx, root, conn)
+		iso := newIsolator(config{isolation: IsolationShared}, fork, true)
+
+		_ = iso.lease(t)
+		require.Equal(t, []string{"groclick_shared_run_1"}, fork.remaining())
+
+		cancel()
+
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			require.FailNow(t, "retained databases are not dropped")
+		}
+
+		assert.Empty(t, fork.remaining())
+		assert.Empty(t, fork.retained)
+	})
+}
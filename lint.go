@@ -0,0 +1,489 @@
+package groclick
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/godepo/groclick/internal/pkg/sqltoken"
+	"github.com/spf13/afero"
+)
+
+const (
+	SeverityOff Severity = iota
+	SeverityInfo
+	SeverityWarning
+	SeverityError
+)
+
+const (
+	RuleMissingEngine         = "missing-engine"
+	RuleMergeTreeOrderBy      = "mergetree-order-by"
+	RuleMutationWithoutSync   = "mutation-without-sync"
+	RuleCreateWithoutIfExists = "create-without-if-not-exists"
+	RuleHardcodedDatabase     = "hardcoded-database"
+	RuleOnClusterInconsistent = "on-cluster-inconsistent"
+)
+
+var ErrMigrationLint = errors.New("migrations have lint errors")
+
+var defaultLintSeverities = map[string]Severity{
+	RuleMissingEngine:         SeverityError,
+	RuleMergeTreeOrderBy:      SeverityError,
+	RuleMutationWithoutSync:   SeverityWarning,
+	RuleCreateWithoutIfExists: SeverityWarning,
+	RuleHardcodedDatabase:     SeverityError,
+	RuleOnClusterInconsistent: SeverityWarning,
+}
+
+var severityNames = map[Severity]string{
+	SeverityOff:     "off",
+	SeverityInfo:    "info",
+	SeverityWarning: "warning",
+	SeverityError:   "error",
+}
+
+type (
+	Severity int
+
+	// LintConfig overrides default severity of rules, SeverityOff disables rule. Settings are settings
+	// migrations run with, they are used to check mutations_sync. Rewritten databases are not reported
+	// as hardcoded.
+	LintConfig struct {
+		Severities map[string]Severity
+		Settings   clickhouse.Settings
+		Rewritten  []string
+	}
+
+	Diagnostic struct {
+		File     string
+		Line     int
+		Rule     string
+		Severity Severity
+		Message  string
+	}
+
+	lintStatement struct {
+		file   string
+		tokens []sqltoken.Token
+		words  []int
+		depth  []int
+	}
+
+	lintCreate struct {
+		kind        string
+		name        int
+		ifNotExists bool
+		orReplace   bool
+		temporary   bool
+	}
+
+	clusterUsage struct {
+		statement lintStatement
+		at        int
+		cluster   string
+	}
+
+	linter struct {
+		cfg           LintConfig
+		diagnostics   []Diagnostic
+		mutationsSync bool
+		clustered     []clusterUsage
+		local         []clusterUsage
+	}
+)
+
+// WithMigrationLint validates plain migrations before bootstrap, diagnostics with error severity fail
+// bootstrap, others are logged.
+func WithMigrationLint(lint LintConfig) Option {
+	return func(c *config) {
+		c.lint = &lint
+	}
+}
+
+func (s Severity) String() string {
+	if name, ok := severityNames[s]; ok {
+		return name
+	}
+
+	return strconv.Itoa(int(s))
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s: %s", d.File, d.Line, d.Severity, d.Rule, d.Message)
+}
+
+// LintMigrations statically checks migrations from path for common ClickHouse pitfalls.
+func LintMigrations(fs afero.Fs, path string, cfg LintConfig) ([]Diagnostic, error) {
+	files, err := readMigrations(fs, path)
+	if err != nil {
+		return nil, err
+	}
+
+	lint := &linter{cfg: cfg}
+	for _, file := range files {
+		lint.file(file.name, file.data)
+	}
+
+	return lint.finish(), nil
+}
+
+// LintSQL statically checks single migration file.
+func LintSQL(file, sql string, cfg LintConfig) []Diagnostic {
+	lint := &linter{cfg: cfg}
+	lint.file(file, sql)
+
+	return lint.finish()
+}
+
+func lintAtBootstrap(cfg config, path string) error {
+	if cfg.lint == nil {
+		return nil
+	}
+
+	lint := *cfg.lint
+	lint.Settings = mergeSettings(cfg.settings, lint.Settings)
+	lint.Rewritten = append(slices.Clone(lint.Rewritten), cfg.databaseRewrite...)
+	for _, db := range cfg.databases {
+		lint.Rewritten = append(lint.Rewritten, db.Name)
+	}
+
+	diagnostics, err := LintMigrations(cfg.fs, path, lint)
+	if err != nil {
+		return err
+	}
+
+	failed := make([]string, 0)
+
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			failed = append(failed, d.String())
+
+			continue
+		}
+
+		cfg.log().Warn("migration lint",
+			slog.String("file", d.File),
+			slog.Int("line", d.Line),
+			slog.String("rule", d.Rule),
+			slog.String("severity", d.Severity.String()),
+			slog.String("message", d.Message),
+		)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%w:\n%s", ErrMigrationLint, strings.Join(failed, "\n"))
+	}
+
+	return nil
+}
+
+func (l *linter) file(name, sql string) {
+	for _, tokens := range sqltoken.Split(sql) {
+		l.statement(newLintStatement(name, tokens))
+	}
+}
+
+func (l *linter) statement(s lintStatement) {
+	if len(s.words) == 0 {
+		return
+	}
+
+	if s.word(0).Is("SET") && s.contains("mutations_sync") {
+		l.mutationsSync = true
+
+		return
+	}
+
+	if create, ok := s.create(); ok {
+		l.checkCreate(s, create)
+	}
+
+	l.checkMutation(s)
+	l.checkHardcodedDatabase(s)
+	l.collectCluster(s)
+}
+
+func (l *linter) checkCreate(s lintStatement, create lintCreate) {
+	if !create.ifNotExists && !create.orReplace && !create.temporary {
+		l.report(s, 0, RuleCreateWithoutIfExists,
+			"CREATE "+create.kind+" without IF NOT EXISTS is not idempotent")
+	}
+
+	if create.temporary || (create.kind != "TABLE" && create.kind != "MATERIALIZED VIEW") {
+		return
+	}
+
+	engine := s.find(create.name, "ENGINE")
+	if engine < 0 {
+		if create.kind == "MATERIALIZED VIEW" && s.find(create.name, "TO") >= 0 {
+			return
+		}
+
+		if s.clones(create.name) {
+			return
+		}
+
+		l.report(s, 0, RuleMissingEngine, "CREATE "+create.kind+" without ENGINE")
+
+		return
+	}
+
+	name := engine + 1
+	if name < len(s.words) && s.word(name).Text == "=" {
+		name++
+	}
+
+	if name >= len(s.words) || !strings.HasSuffix(strings.ToLower(s.word(name).Text), "mergetree") {
+		return
+	}
+
+	for i := name + 1; i+1 < len(s.words); i++ {
+		if s.depth[i] != 0 {
+			continue
+		}
+
+		if s.word(i).Is("AS") {
+			break
+		}
+
+		if (s.word(i).Is("ORDER") || s.word(i).Is("PRIMARY")) && s.word(i+1).Is("BY", "KEY") {
+			return
+		}
+	}
+
+	l.report(s, name, RuleMergeTreeOrderBy, s.word(name).Text+" engine without ORDER BY")
+}
+
+func (l *linter) checkMutation(s lintStatement) {
+	if !s.word(0).Is("ALTER") || len(s.words) < 2 || !s.word(1).Is("TABLE") {
+		return
+	}
+
+	if l.mutationsSync || l.cfg.Settings["mutations_sync"] != nil || s.contains("mutations_sync") {
+		return
+	}
+
+	command := mutationCommand(s)
+
+	for i := command; i < len(s.words); i++ {
+		if s.depth[i] != 0 || !s.word(i).Is("UPDATE", "DELETE") {
+			continue
+		}
+
+		// DELETE of TTL expression isn't a mutation, commands follow table name or comma
+		if i == command || s.word(i-1).Text == "," {
+			l.report(s, i, RuleMutationWithoutSync,
+				"ALTER TABLE ... "+strings.ToUpper(s.word(i).Text)+" runs asynchronously, set mutations_sync")
+
+			return
+		}
+	}
+}
+
+// mutationCommand returns position of first command of ALTER TABLE [IF EXISTS] [db.]table [ON CLUSTER c].
+func mutationCommand(s lintStatement) int {
+	pos := 2
+	at := func(i int) sqltoken.Token {
+		if i >= len(s.words) {
+			return sqltoken.Token{}
+		}
+
+		return s.word(i)
+	}
+
+	if at(pos).Is("IF") && at(pos+1).Is("EXISTS") {
+		pos += 2
+	}
+	pos++
+
+	if at(pos).Text == "." {
+		pos += 2
+	}
+
+	if at(pos).Is("ON") && at(pos+1).Is("CLUSTER") {
+		pos += 3
+	}
+
+	return pos
+}
+
+func (l *linter) checkHardcodedDatabase(s lintStatement) {
+	for i := 0; i+3 < len(s.words); i++ {
+		if !s.word(i).Is("TABLE", "VIEW", "DICTIONARY", "INTO", "TO", "FROM", "JOIN", "EXISTS") {
+			continue
+		}
+
+		db := s.word(i + 1)
+		if !db.IsIdentifier() || s.word(i+2).Text != "." || !s.word(i+3).IsIdentifier() {
+			continue
+		}
+
+		if strings.EqualFold(db.Value(), "system") || strings.EqualFold(db.Value(), "information_schema") ||
+			slices.Contains(l.cfg.Rewritten, db.Value()) {
+			continue
+		}
+
+		l.report(s, i+1, RuleHardcodedDatabase,
+			"database "+db.Value()+" is hardcoded, it doesn't match database created for test")
+	}
+}
+
+func (l *linter) collectCluster(s lintStatement) {
+	tokens := s.tokens
+	if _, ok := clusterClausePosition(tokens, s.words); !ok {
+		return
+	}
+
+	for i := 0; i+2 < len(s.words); i++ {
+		if s.word(i).Is("ON") && s.word(i+1).Is("CLUSTER") {
+			l.clustered = append(l.clustered, clusterUsage{statement: s, at: i, cluster: s.word(i + 2).Value()})
+
+			return
+		}
+	}
+
+	l.local = append(l.local, clusterUsage{statement: s})
+}
+
+func (l *linter) finish() []Diagnostic {
+	if len(l.clustered) > 0 {
+		for _, usage := range l.local {
+			l.report(usage.statement, 0, RuleOnClusterInconsistent,
+				"statement without ON CLUSTER, other migrations use ON CLUSTER "+l.clustered[0].cluster)
+		}
+
+		for _, usage := range l.clustered[1:] {
+			if usage.cluster != l.clustered[0].cluster {
+				l.report(usage.statement, usage.at, RuleOnClusterInconsistent,
+					"ON CLUSTER "+usage.cluster+" differs from ON CLUSTER "+l.clustered[0].cluster)
+			}
+		}
+	}
+
+	return l.diagnostics
+}
+
+func (l *linter) report(s lintStatement, at int, rule, message string) {
+	severity, ok := l.cfg.Severities[rule]
+	if !ok {
+		severity = defaultLintSeverities[rule]
+	}
+
+	if severity == SeverityOff {
+		return
+	}
+
+	l.diagnostics = append(l.diagnostics, Diagnostic{
+		File:     s.file,
+		Line:     s.word(at).Line,
+		Rule:     rule,
+		Severity: severity,
+		Message:  message,
+	})
+}
+
+func newLintStatement(file string, tokens []sqltoken.Token) lintStatement {
+	words := sqltoken.Significant(tokens)
+	depth := make([]int, len(words))
+	level := 0
+
+	for i, at := range words {
+		if tokens[at].Text == ")" {
+			level = max(level-1, 0)
+		}
+
+		depth[i] = level
+
+		if tokens[at].Text == "(" {
+			level++
+		}
+	}
+
+	return lintStatement{file: file, tokens: tokens, words: words, depth: depth}
+}
+
+func (s lintStatement) word(i int) sqltoken.Token {
+	return s.tokens[s.words[i]]
+}
+
+func (s lintStatement) find(from int, keyword string) int {
+	for i := from; i < len(s.words); i++ {
+		if s.depth[i] == 0 && s.word(i).Is(keyword) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (s lintStatement) contains(word string) bool {
+	for i := range s.words {
+		if strings.EqualFold(s.word(i).Value(), word) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clones reports CREATE TABLE name AS other_table or AS table_function(...), which take engine from source.
+func (s lintStatement) clones(name int) bool {
+	for i := name; i+1 < len(s.words); i++ {
+		if s.depth[i] != 0 || !s.word(i).Is("AS") {
+			continue
+		}
+
+		next := s.word(i + 1)
+
+		return next.IsIdentifier() && !next.Is("SELECT", "WITH")
+	}
+
+	return false
+}
+
+func (s lintStatement) create() (lintCreate, bool) {
+	pos := 0
+	skip := func(keywords ...string) bool {
+		if pos < len(s.words) && s.word(pos).Is(keywords...) {
+			pos++
+
+			return true
+		}
+
+		return false
+	}
+
+	if !skip("CREATE") {
+		return lintCreate{}, false
+	}
+
+	res := lintCreate{}
+	if skip("OR") {
+		res.orReplace = skip("REPLACE")
+	}
+	res.temporary = skip("TEMPORARY")
+
+	start := pos
+	if !skipObjectKind(skip) {
+		return lintCreate{}, false
+	}
+
+	kind := make([]string, 0, pos-start)
+	for i := start; i < pos; i++ {
+		kind = append(kind, strings.ToUpper(s.word(i).Text))
+	}
+	res.kind = strings.Join(kind, " ")
+
+	if skip("IF") {
+		res.ifNotExists = skip("NOT") && skip("EXISTS")
+	}
+
+	res.name = pos
+
+	return res, pos < len(s.words)
+}
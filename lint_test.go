@@ -0,0 +1,171 @@
+package groclick
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/google/uuid"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lintRules(diagnostics []Diagnostic) []string {
+	res := make([]string, 0, len(diagnostics))
+
+	for _, d := range diagnostics {
+		res = append(res, d.Rule)
+	}
+
+	return res
+}
+
+func TestLintSQL(t *testing.T) {
+	cases := map[string]struct {
+		sql string
+		exp []string
+	}{
+		"valid table": {
+			sql: "CREATE TABLE IF NOT EXISTS t (id UInt64) ENGINE = ReplacingMergeTree() ORDER BY id",
+			exp: []string{},
+		},
+		"missing engine": {
+			sql: "CREATE TABLE IF NOT EXISTS t (id UInt64)",
+			exp: []string{RuleMissingEngine},
+		},
+		"clone of other table": {
+			sql: "CREATE TABLE IF NOT EXISTS t AS other",
+			exp: []string{},
+		},
+		"materialized view to table": {
+			sql: "CREATE MATERIALIZED VIEW IF NOT EXISTS mv TO t AS SELECT id FROM src",
+			exp: []string{},
+		},
+		"materialized view without engine": {
+			sql: "CREATE MATERIALIZED VIEW IF NOT EXISTS mv AS SELECT id FROM src",
+			exp: []string{RuleMissingEngine},
+		},
+		"merge tree without order by": {
+			sql: "CREATE TABLE IF NOT EXISTS t (id UInt64) ENGINE = MergeTree() PARTITION BY (id % 10)",
+			exp: []string{RuleMergeTreeOrderBy},
+		},
+		"merge tree with primary key": {
+			sql: "CREATE TABLE IF NOT EXISTS t (id UInt64) ENGINE = MergeTree PRIMARY KEY id",
+			exp: []string{},
+		},
+		"order by in select only": {
+			sql: "CREATE TABLE IF NOT EXISTS t ENGINE = MergeTree AS SELECT id FROM src ORDER BY id",
+			exp: []string{RuleMergeTreeOrderBy},
+		},
+		"not idempotent create": {
+			sql: "CREATE TABLE t (id UInt64) ENGINE = Memory",
+			exp: []string{RuleCreateWithoutIfExists},
+		},
+		"create or replace": {
+			sql: "CREATE OR REPLACE DICTIONARY d (id UInt64) PRIMARY KEY id",
+			exp: []string{},
+		},
+		"mutation without sync": {
+			sql: "ALTER TABLE t UPDATE x = 1 WHERE id IN (SELECT id FROM system.numbers)",
+			exp: []string{RuleMutationWithoutSync},
+		},
+		"mutation on cluster after command": {
+			sql: "ALTER TABLE IF EXISTS db.t ON CLUSTER main ADD COLUMN x UInt8, DELETE WHERE x = 0",
+			exp: []string{RuleMutationWithoutSync, RuleHardcodedDatabase},
+		},
+		"ttl delete": {
+			sql: "ALTER TABLE t MODIFY TTL d + INTERVAL 1 DAY DELETE",
+			exp: []string{},
+		},
+		"mutation after set": {
+			sql: "SET mutations_sync = 2; ALTER TABLE t DELETE WHERE id = 1",
+			exp: []string{},
+		},
+		"hardcoded database": {
+			sql: "CREATE TABLE IF NOT EXISTS analytics.t (id UInt64) ENGINE = Memory;\n" +
+				"INSERT INTO `analytics`.t SELECT * FROM system.numbers LIMIT 1",
+			exp: []string{RuleHardcodedDatabase, RuleHardcodedDatabase},
+		},
+		"on cluster inconsistent": {
+			sql: "CREATE TABLE IF NOT EXISTS a ON CLUSTER main (id UInt8) ENGINE = Memory;\n" +
+				"CREATE TABLE IF NOT EXISTS b (id UInt8) ENGINE = Memory;\n" +
+				"CREATE TABLE IF NOT EXISTS c ON CLUSTER other (id UInt8) ENGINE = Memory",
+			exp: []string{RuleOnClusterInconsistent, RuleOnClusterInconsistent},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.exp, lintRules(LintSQL("001.sql", tc.sql, LintConfig{})))
+		})
+	}
+
+	t.Run("should be able to report position and severity", func(t *testing.T) {
+		res := LintSQL("001.sql", "\n\nCREATE TABLE t (id UInt8)", LintConfig{
+			Severities: map[string]Severity{RuleCreateWithoutIfExists: SeverityOff},
+		})
+		require.Len(t, res, 1)
+		assert.Equal(t, "001.sql:3: error: missing-engine: CREATE TABLE without ENGINE", res[0].String())
+	})
+
+	t.Run("should be able to skip rewritten databases", func(t *testing.T) {
+		res := LintSQL("001.sql", "CREATE TABLE IF NOT EXISTS analytics.t (id UInt8) ENGINE = Memory", LintConfig{
+			Rewritten: []string{"analytics"},
+		})
+		assert.Empty(t, res)
+	})
+
+	t.Run("should be able to skip mutation check with settings", func(t *testing.T) {
+		res := LintSQL("001.sql", "ALTER TABLE t DELETE WHERE 1", LintConfig{
+			Settings: clickhouse.Settings{"mutations_sync": 2},
+		})
+		assert.Empty(t, res)
+	})
+}
+
+func TestLintMigrations(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/migrations/001.sql",
+		[]byte("CREATE TABLE IF NOT EXISTS a ON CLUSTER main (id UInt8) ENGINE = Memory"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/migrations/002.sql",
+		[]byte("ALTER TABLE a ADD COLUMN x UInt8"), 0o644))
+
+	t.Run("should be able to lint across files", func(t *testing.T) {
+		res, err := LintMigrations(fs, "/migrations", LintConfig{})
+		require.NoError(t, err)
+		require.Len(t, res, 1)
+		assert.Equal(t, "002.sql", res[0].File)
+		assert.Equal(t, RuleOnClusterInconsistent, res[0].Rule)
+	})
+
+	t.Run("should be able to fail when dir not exists", func(t *testing.T) {
+		_, err := LintMigrations(fs, "/"+uuid.NewString(), LintConfig{})
+		require.Error(t, err)
+	})
+
+	t.Run("should be able to fail bootstrap on errors", func(t *testing.T) {
+		require.NoError(t, afero.WriteFile(fs, "/broken/001.sql", []byte("CREATE TABLE db.t (id UInt8)"), 0o644))
+
+		_, err := bootstrapper[Deps](config{
+			fs:             fs,
+			migrationsPath: "/broken",
+			lint:           &LintConfig{},
+		})(context.Background())
+		require.ErrorIs(t, err, ErrMigrationLint)
+		assert.Contains(t, err.Error(), "001.sql:1: error: missing-engine")
+		assert.Contains(t, err.Error(), "001.sql:1: error: hardcoded-database")
+	})
+
+	t.Run("should be able to pass bootstrap lint with warnings", func(t *testing.T) {
+		logger, buf := newBufferedLogger()
+
+		require.NoError(t, lintAtBootstrap(config{
+			fs:             fs,
+			migrationsPath: "/migrations",
+			lint:           &LintConfig{},
+			logger:         logger,
+		}, "/migrations"))
+		assert.Contains(t, buf.String(), "rule=on-cluster-inconsistent")
+	})
+}
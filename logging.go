@@ -0,0 +1,20 @@
+package groclick
+
+import (
+	"log/slog"
+)
+
+// WithLogger sets logger for bootstrap, database lifecycle and migration events, slog.Default is used by default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+func (c config) log() *slog.Logger {
+	if c.logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+
+	return c.logger
+}
@@ -0,0 +1,75 @@
+package groclick
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newBufferedLogger() (*slog.Logger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+
+	return slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug})), buf
+}
+
+func TestLogging(t *testing.T) {
+	t.Run("should be able to log database lifecycle", func(t *testing.T) {
+		root := NewMockConn(t)
+		conn := NewMockConn(t)
+		logger, buf := newBufferedLogger()
+
+		fork := newForker(t.Context(), root, isolationDSN, "", config{
+			runID:  "run",
+			logger: logger,
+			connConstructor: func(opt *clickhouse.Options) (driver.Conn, error) {
+				return conn, nil
+			},
+			migrator: func(ctx context.Context, migratorConfig MigratorConfig) error {
+				assert.Same(t, logger, migratorConfig.Logger)
+				return nil
+			},
+		})
+
+		root.EXPECT().Exec(mock.Anything, "CREATE DATABASE `groclick_run_1`").Return(nil)
+		root.EXPECT().Exec(mock.Anything, "DROP DATABASE `groclick_run_1`").Return(nil).Once()
+		root.EXPECT().Exec(mock.Anything, "DROP DATABASE `groclick_run_1`").Return(assert.AnError).Once()
+		conn.EXPECT().Ping(mock.Anything).Return(nil)
+
+		cfg := fork.fork(t, "", nil, nil).primary().cfg
+		require.NoError(t, fork.drop(t.Context(), cfg.Auth.Database))
+		require.Error(t, fork.drop(t.Context(), cfg.Auth.Database))
+
+		out := buf.String()
+		assert.Contains(t, out, `level=DEBUG msg="database created"`)
+		assert.Contains(t, out, `level=DEBUG msg="migrations applied"`)
+		assert.Contains(t, out, `level=DEBUG msg="database dropped" database=groclick_run_1`)
+		assert.Contains(t, out, `level=WARN msg="can't drop database" database=groclick_run_1`)
+	})
+
+	t.Run("should be able to log applied migrations", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		db := NewMockDB(t)
+		logger, buf := newBufferedLogger()
+
+		require.NoError(t, afero.WriteFile(fs, "/migrations/001_init.sql", []byte("CREATE TABLE t (id UInt8)"), 0o644))
+		db.EXPECT().Exec(mock.Anything, "CREATE TABLE t (id UInt8)").Return(nil)
+
+		mig, err := PlainMigrator(fs, "/migrations")
+		require.NoError(t, err)
+		require.NoError(t, mig(t.Context(), MigratorConfig{DB: db, DBName: "groclick", Logger: logger}))
+
+		assert.Contains(t, buf.String(), `msg="migration applied" database=groclick migration=001_init.sql`)
+	})
+
+	t.Run("should be able to discard logs without logger", func(t *testing.T) {
+		assert.NotNil(t, config{}.log())
+	})
+}
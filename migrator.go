@@ -4,16 +4,102 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/godepo/groclick/internal/pkg/sqltoken"
 	"github.com/spf13/afero"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const defaultExpMigrations = 8
 
+type migrationFile struct {
+	name string
+	data string
+}
+
 func PlainMigrator(fs afero.Fs, path string) (Migrator, error) {
-	migrations := make([]string, 0, defaultExpMigrations)
+	files, err := readMigrations(fs, path)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]string, 0, len(files))
+	names := make([]string, 0, len(files))
+
+	for _, file := range files {
+		migrations = append(migrations, file.data)
+		names = append(names, file.name)
+	}
+
+	return func(ctx context.Context, cfg MigratorConfig) error {
+		logger := cfg.Logger
+		if logger == nil {
+			logger = slog.New(slog.DiscardHandler)
+		}
+
+		for i, migration := range migrations {
+			startedAt := time.Now()
+			migrationCtx, span := startSpan(ctx, "groclick.migration", attribute.String("migration", names[i]))
+
+			for j, tokens := range sqltoken.Split(migration) {
+				cmd := strings.TrimSpace(sqltoken.Join(tokens))
+				cmd = RewriteDatabases(ExpandVariables(cmd, cfg.Variables), cfg.Databases)
+				cmd = RewriteFunctions(cmd, cfg.Functions)
+
+				for _, stmt := range cfg.StandIns.Rewrite(cmd) {
+					stmt = onCluster(stmt, cfg.Cluster)
+
+					stmtCtx, stmtSpan := startSpan(migrationCtx, "groclick.migration.statement",
+						attribute.String("db.statement", stmt))
+					err := cfg.DB.Exec(stmtCtx, stmt)
+					endSpan(stmtSpan, err)
+
+					if err != nil {
+						endSpan(span, err)
+
+						return fmt.Errorf(
+							"can't execute migration num=%d and command=%d %s: %w",
+							i, j,
+							stmt,
+							err,
+						)
+					}
+				}
+			}
+
+			span.End()
+
+			logger.Debug("migration applied",
+				slog.String("database", cfg.DBName),
+				slog.String("migration", names[i]),
+				slog.Duration("duration", time.Since(startedAt)),
+			)
+		}
+
+		return nil
+	}, nil
+}
+
+// ExpandVariables replaces ${name} placeholders with values of variables, unknown placeholders are kept.
+func ExpandVariables(statement string, variables map[string]string) string {
+	if len(variables) == 0 || !strings.Contains(statement, "${") {
+		return statement
+	}
+
+	pairs := make([]string, 0, len(variables)*2)
+	for name, value := range variables {
+		pairs = append(pairs, "${"+name+"}", value)
+	}
+
+	return strings.NewReplacer(pairs...).Replace(statement)
+}
+
+func readMigrations(fs afero.Fs, path string) ([]migrationFile, error) {
+	files := make([]migrationFile, 0, defaultExpMigrations)
 
 	dir, err := fs.Open(path)
 	if err != nil {
@@ -39,36 +125,25 @@ func PlainMigrator(fs afero.Fs, path string) (Migrator, error) {
 			return nil, err
 		}
 
-		migrations = append(migrations, data)
+		files = append(files, migrationFile{name: info.Name(), data: data})
 	}
 
-	return func(ctx context.Context, cfg MigratorConfig) error {
-		for i, migration := range migrations {
-			for j, cmd := range strings.Split(migration, ";") {
-				cmd = strings.TrimSpace(cmd)
-				if cmd == "" {
-					continue
-				}
+	return files, nil
+}
 
-				if err := cfg.DB.Exec(ctx, cmd); err != nil {
-					return fmt.Errorf(
-						"can't execute migration num=%d and command=%d %s: %w",
-						i, j,
-						cmd,
-						err,
-					)
-				}
-			}
-		}
+func readMigrationFile(fs afero.Fs, filePath string) (string, error) {
+	data, err := readFile(fs, filePath)
+	if err != nil {
+		return "", fmt.Errorf("can't read migration: %w", err)
+	}
 
-		return nil
-	}, nil
+	return string(data), nil
 }
 
-func readMigrationFile(fs afero.Fs, filePath string) (string, error) {
-	fh, err := fs.Open(filePath)
+func readFile(fs afero.Fs, path string) ([]byte, error) {
+	fh, err := fs.Open(path)
 	if err != nil {
-		return "", fmt.Errorf("can't open migration file %s: %w", filePath, err)
+		return nil, fmt.Errorf("can't open file %s: %w", path, err)
 	}
 
 	defer func(fh afero.File) {
@@ -77,8 +152,8 @@ func readMigrationFile(fs afero.Fs, filePath string) (string, error) {
 
 	data, err := io.ReadAll(fh)
 	if err != nil {
-		return "", fmt.Errorf("can't read file %s: %w", filePath, err)
+		return nil, fmt.Errorf("can't read file %s: %w", path, err)
 	}
 
-	return string(data), nil
+	return data, nil
 }
@@ -248,3 +248,37 @@ func ArrangeExpectError(_ *testing.T, state MigratorState) MigratorState {
 	state.ExpectError = errors.New(uuid.NewString())
 	return state
 }
+
+func TestExpandVariables(t *testing.T) {
+	variables := map[string]string{"kafka_broker": "groclick-redpanda:9092", "kafka_topic_events": "db_events"}
+
+	assert.Equal(t,
+		"CREATE TABLE q ENGINE = Kafka('groclick-redpanda:9092', 'db_events', '${kafka_group}', 'JSONEachRow')",
+		ExpandVariables(
+			"CREATE TABLE q ENGINE = Kafka('${kafka_broker}', '${kafka_topic_events}', '${kafka_group}', 'JSONEachRow')",
+			variables,
+		),
+	)
+	assert.Equal(t, "SELECT '${kafka_broker}'", ExpandVariables("SELECT '${kafka_broker}'", nil))
+}
+
+func TestPlainMigrator_Statements(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/sql/001.sql", []byte(
+		"-- create table; with comment\n"+
+			"CREATE TABLE t (id UInt64) ENGINE = Memory COMMENT 'ids; of users';\n"+
+			"  ;\n"+
+			"INSERT INTO t VALUES (1); -- trailing; comment",
+	), certFileMode))
+
+	migrator, err := PlainMigrator(fs, "/sql")
+	require.NoError(t, err)
+
+	db := NewMockDB(t)
+	db.EXPECT().
+		Exec(mock.Anything, "-- create table; with comment\nCREATE TABLE t (id UInt64) ENGINE = Memory COMMENT 'ids; of users'").
+		Return(nil).Once()
+	db.EXPECT().Exec(mock.Anything, "INSERT INTO t VALUES (1)").Return(nil).Once()
+
+	require.NoError(t, migrator(t.Context(), MigratorConfig{DB: db}))
+}
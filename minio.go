@@ -0,0 +1,182 @@
+package groclick
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/google/uuid"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const (
+	defaultMinIOImage = "minio/minio:RELEASE.2024-12-18T13-15-44Z"
+	minioAlias        = "groclick-minio"
+	minioPort         = nat.Port("9000/tcp")
+	minioBucket       = "groclick"
+	minioClientAlias  = "groclick"
+	s3Collection      = "groclick_s3"
+	s3ConfigPath      = "/etc/clickhouse-server/config.d/groclick-s3.xml"
+)
+
+type (
+	// S3 is bucket prefix leased by test in MinIO companion. Endpoint is reachable by ClickHouse server,
+	// HostEndpoint is reachable by test. Collection is ClickHouse named collection with bucket URL and
+	// credentials, s3() table function and S3 engine accept it with filename taken from Key.
+	S3 struct {
+		Endpoint     string
+		HostEndpoint string
+		Bucket       string
+		Prefix       string
+		AccessKey    string
+		SecretKey    string
+		Collection   string
+	}
+
+	minioCompanion struct {
+		ctx       context.Context
+		container CompanionContainer
+		s3        S3
+		runID     string
+		prefixes  atomic.Int32
+	}
+)
+
+// WithMinIO starts MinIO companion on network shared with ClickHouse and injects S3 into tests.
+func WithMinIO() Option {
+	return func(c *config) {
+		if c.minioImage == "" {
+			c.minioImage = defaultMinIOImage
+		}
+	}
+}
+
+func WithMinIOImage(image string) Option {
+	return func(c *config) {
+		c.minioImage = image
+	}
+}
+
+func WithInjectLabelForS3(label string) Option {
+	return func(c *config) {
+		c.injectLabelForS3 = label
+	}
+}
+
+// URL returns URL of key under test prefix reachable by ClickHouse server, it's suitable for BACKUP TO S3.
+func (s S3) URL(key string) string {
+	return s.Endpoint + "/" + s.Bucket + "/" + s.Key(key)
+}
+
+// Key returns key under test prefix.
+func (s S3) Key(key string) string {
+	return s.Prefix + key
+}
+
+func startMinIO(ctx context.Context, cfg config, companions *companions) (*minioCompanion, error) {
+	accessKey := "groclick" + newRunID()
+	secretKey := strings.ReplaceAll(uuid.NewString(), "-", "")
+
+	container, err := companions.run(ctx, cfg, minioAlias, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        cfg.minioImage,
+			Cmd:          []string{"server", "/data"},
+			ExposedPorts: []string{string(minioPort)},
+			Tmpfs:        map[string]string{"/data": "rw"},
+			Env: map[string]string{
+				"MINIO_ROOT_USER":     accessKey,
+				"MINIO_ROOT_PASSWORD": secretKey,
+			},
+			WaitingFor: wait.ForHTTP("/minio/health/live").WithPort(minioPort),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	hostEndpoint, err := container.PortEndpoint(ctx, minioPort, "http")
+	if err != nil {
+		return nil, fmt.Errorf("can't get minio endpoint: %w", err)
+	}
+
+	err = execCompanion(ctx, container, "mc", "alias", "set", minioClientAlias,
+		"http://localhost:"+minioPort.Port(), accessKey, secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	err = execCompanion(ctx, container, "mc", "mb", "--ignore-existing", minioClientAlias+"/"+minioBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return &minioCompanion{
+		ctx:       ctx,
+		container: container,
+		runID:     cfg.runID,
+		s3: S3{
+			Endpoint:     "http://" + minioAlias + ":" + minioPort.Port(),
+			HostEndpoint: hostEndpoint,
+			Bucket:       minioBucket,
+			AccessKey:    accessKey,
+			SecretKey:    secretKey,
+			Collection:   s3Collection,
+		},
+	}, nil
+}
+
+func (m *minioCompanion) customizer() testcontainers.CustomizeRequestOption {
+	return func(req *testcontainers.GenericContainerRequest) error {
+		req.Files = append(req.Files, testcontainers.ContainerFile{
+			Reader:            strings.NewReader(s3Config(m.s3)),
+			ContainerFilePath: s3ConfigPath,
+			FileMode:          certFileMode,
+		})
+
+		return nil
+	}
+}
+
+func (m *minioCompanion) lease(t *testing.T) S3 {
+	t.Helper()
+
+	res := m.s3
+	res.Prefix = m.runID + "/" + sanitizeIdentifier(t.Name()) + "_" + strconv.Itoa(int(m.prefixes.Add(1))) + "/"
+
+	t.Cleanup(func() {
+		err := execCompanion(m.ctx, m.container, "mc", "rm", "--recursive", "--force",
+			minioClientAlias+"/"+res.Bucket+"/"+res.Prefix)
+		if err != nil {
+			t.Logf("can't cleanup s3 prefix %s: %v", res.Prefix, err)
+		}
+	})
+
+	return res
+}
+
+// s3Config declares named collection and endpoint credentials, so s3 functions and backups don't need keys.
+func s3Config(s3 S3) string {
+	url := s3.Endpoint + "/" + s3.Bucket + "/"
+	credentials := `
+            <access_key_id>` + s3.AccessKey + `</access_key_id>
+            <secret_access_key>` + s3.SecretKey + `</secret_access_key>`
+
+	return `<clickhouse>
+    <named_collections>
+        <` + s3.Collection + `>
+            <url>` + url + `</url>` + credentials + `
+        </` + s3.Collection + `>
+    </named_collections>
+    <s3>
+        <` + s3.Collection + `>
+            <endpoint>` + url + `</endpoint>` + credentials + `
+        </` + s3.Collection + `>
+    </s3>
+</clickhouse>
+`
+}
@@ -0,0 +1,109 @@
+package groclick
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestMinIO(t *testing.T) {
+	var calls []string
+
+	cont := NewMockCompanionContainer(t)
+
+	var req testcontainers.GenericContainerRequest
+
+	cfg := companionConfig(&calls, func(
+		ctx context.Context,
+		r testcontainers.GenericContainerRequest,
+	) (CompanionContainer, error) {
+		req = r
+		return cont, nil
+	})
+	cfg.runID = "run"
+	cfg.minioImage = defaultMinIOImage
+	cfg.injectLabelForS3 = "clickhouse.s3"
+
+	cont.EXPECT().PortEndpoint(mock.Anything, minioPort, "http").Return("http://localhost:32768", nil)
+	cont.EXPECT().Exec(mock.Anything, mock.MatchedBy(func(cmd []string) bool {
+		return len(cmd) > 2 && cmd[1] == "alias" && cmd[5] == req.Env["MINIO_ROOT_USER"]
+	}), mock.Anything).Return(0, nil, nil)
+	cont.EXPECT().Exec(mock.Anything, []string{"mc", "mb", "--ignore-existing", "groclick/groclick"}, mock.Anything).
+		Return(0, nil, nil)
+
+	comps, err := startCompanions(t.Context(), cfg)
+	require.NoError(t, err)
+	require.NotNil(t, comps.s3)
+
+	assert.Equal(t, []string{"groclick-net"}, req.Networks)
+	assert.Equal(t, []string{minioAlias}, req.NetworkAliases["groclick-net"])
+
+	t.Run("should be able to declare named collection", func(t *testing.T) {
+		click := testcontainers.GenericContainerRequest{}
+		for _, customizer := range comps.customizers() {
+			require.NoError(t, customizer.Customize(&click))
+		}
+
+		require.Len(t, click.Files, 1)
+		assert.Equal(t, s3ConfigPath, click.Files[0].ContainerFilePath)
+
+		data, err := io.ReadAll(click.Files[0].Reader)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "<url>http://groclick-minio:9000/groclick/</url>")
+		assert.Contains(t, string(data), "<secret_access_key>"+req.Env["MINIO_ROOT_PASSWORD"]+"</secret_access_key>")
+	})
+
+	t.Run("should be able to inject bucket prefix", func(t *testing.T) {
+		var res struct {
+			S3 S3 `groat:"clickhouse.s3"`
+		}
+
+		t.Run("Case", func(t *testing.T) {
+			cont.EXPECT().
+				Exec(mock.Anything, []string{
+					"mc", "rm", "--recursive", "--force",
+					"groclick/groclick/run/testminio_should_be_able_to_inject_bucket_prefix_case_1/",
+				}, mock.Anything).
+				Return(0, nil, nil).Once()
+
+			res = injectCompanions(t, res, comps, forkedDatabases{{}})
+		})
+
+		assert.Equal(t, "run/testminio_should_be_able_to_inject_bucket_prefix_case_1/", res.S3.Prefix)
+		assert.Equal(t, "http://localhost:32768", res.S3.HostEndpoint)
+		assert.Equal(t, "http://groclick-minio:9000/groclick/"+res.S3.Prefix+"backup", res.S3.URL("backup"))
+		assert.Equal(t, s3Collection, res.S3.Collection)
+	})
+
+	t.Run("should be able failed when can't create bucket", func(t *testing.T) {
+		exp := errors.New(uuid.NewString())
+		broken := NewMockCompanionContainer(t)
+		cfg.companionRunner = func(
+			ctx context.Context,
+			req testcontainers.GenericContainerRequest,
+		) (CompanionContainer, error) {
+			return broken, nil
+		}
+
+		broken.EXPECT().PortEndpoint(mock.Anything, minioPort, "http").Return("http://localhost:32769", nil)
+		broken.EXPECT().Exec(mock.Anything, mock.Anything, mock.Anything).Return(0, nil, exp)
+
+		_, err := startCompanions(t.Context(), cfg)
+		require.ErrorIs(t, err, exp)
+	})
+
+	t.Run("should be able to reject hosted mode", func(t *testing.T) {
+		_, err := hostedBootstrapper[struct{}](config{
+			hostedDBNamespace: "ns",
+			minioImage:        defaultMinIOImage,
+		})(t.Context())
+		require.ErrorIs(t, err, ErrCompanionRequiresContainer)
+	})
+}
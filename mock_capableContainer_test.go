@@ -0,0 +1,406 @@
+// Code generated by mockery; DO NOT EDIT.
+// github.com/vektra/mockery
+// template: testify
+
+package groclick
+
+import (
+	"context"
+	"io"
+
+	"github.com/docker/go-connections/nat"
+	mock "github.com/stretchr/testify/mock"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/exec"
+)
+
+// NewMockCapableContainer creates a new instance of MockCapableContainer. It also registers a testing interface on the mock and a cleanup function to assert the mocks expectations.
+// The first argument is typically a *testing.T value.
+func NewMockCapableContainer(t interface {
+	mock.TestingT
+	Cleanup(func())
+}) *MockCapableContainer {
+	mock := &MockCapableContainer{}
+	mock.Mock.Test(t)
+
+	t.Cleanup(func() { mock.AssertExpectations(t) })
+
+	return mock
+}
+
+// MockCapableContainer is an autogenerated mock type for the capableContainer type
+type MockCapableContainer struct {
+	mock.Mock
+}
+
+type MockCapableContainer_Expecter struct {
+	mock *mock.Mock
+}
+
+func (_m *MockCapableContainer) EXPECT() *MockCapableContainer_Expecter {
+	return &MockCapableContainer_Expecter{mock: &_m.Mock}
+}
+
+// ConnectionString provides a mock function for the type MockCapableContainer
+func (_mock *MockCapableContainer) ConnectionString(ctx context.Context, args ...string) (string, error) {
+	var tmpRet mock.Arguments
+	if len(args) > 0 {
+		tmpRet = _mock.Called(ctx, args)
+	} else {
+		tmpRet = _mock.Called(ctx)
+	}
+	ret := tmpRet
+
+	if len(ret) == 0 {
+		panic("no return value specified for ConnectionString")
+	}
+
+	var r0 string
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, ...string) (string, error)); ok {
+		return returnFunc(ctx, args...)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, ...string) string); ok {
+		r0 = returnFunc(ctx, args...)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, ...string) error); ok {
+		r1 = returnFunc(ctx, args...)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockCapableContainer_ConnectionString_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'ConnectionString'
+type MockCapableContainer_ConnectionString_Call struct {
+	*mock.Call
+}
+
+// ConnectionString is a helper method to define mock.On call
+//   - ctx context.Context
+//   - args ...string
+func (_e *MockCapableContainer_Expecter) ConnectionString(ctx interface{}, args ...interface{}) *MockCapableContainer_ConnectionString_Call {
+	return &MockCapableContainer_ConnectionString_Call{Call: _e.mock.On("ConnectionString",
+		append([]interface{}{ctx}, args...)...)}
+}
+
+func (_c *MockCapableContainer_ConnectionString_Call) Run(run func(ctx context.Context, args ...string)) *MockCapableContainer_ConnectionString_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 []string
+		var variadicArgs []string
+		if len(args) > 1 {
+			variadicArgs = args[1].([]string)
+		}
+		arg1 = variadicArgs
+		run(
+			arg0,
+			arg1...,
+		)
+	})
+	return _c
+}
+
+func (_c *MockCapableContainer_ConnectionString_Call) Return(s string, err error) *MockCapableContainer_ConnectionString_Call {
+	_c.Call.Return(s, err)
+	return _c
+}
+
+func (_c *MockCapableContainer_ConnectionString_Call) RunAndReturn(run func(ctx context.Context, args ...string) (string, error)) *MockCapableContainer_ConnectionString_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Exec provides a mock function for the type MockCapableContainer
+func (_mock *MockCapableContainer) Exec(ctx context.Context, cmd []string, options ...exec.ProcessOption) (int, io.Reader, error) {
+	var tmpRet mock.Arguments
+	if len(options) > 0 {
+		tmpRet = _mock.Called(ctx, cmd, options)
+	} else {
+		tmpRet = _mock.Called(ctx, cmd)
+	}
+	ret := tmpRet
+
+	if len(ret) == 0 {
+		panic("no return value specified for Exec")
+	}
+
+	var r0 int
+	var r1 io.Reader
+	var r2 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, []string, ...exec.ProcessOption) (int, io.Reader, error)); ok {
+		return returnFunc(ctx, cmd, options...)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, []string, ...exec.ProcessOption) int); ok {
+		r0 = returnFunc(ctx, cmd, options...)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, []string, ...exec.ProcessOption) io.Reader); ok {
+		r1 = returnFunc(ctx, cmd, options...)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(io.Reader)
+		}
+	}
+	if returnFunc, ok := ret.Get(2).(func(context.Context, []string, ...exec.ProcessOption) error); ok {
+		r2 = returnFunc(ctx, cmd, options...)
+	} else {
+		r2 = ret.Error(2)
+	}
+	return r0, r1, r2
+}
+
+// MockCapableContainer_Exec_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Exec'
+type MockCapableContainer_Exec_Call struct {
+	*mock.Call
+}
+
+// Exec is a helper method to define mock.On call
+//   - ctx context.Context
+//   - cmd []string
+//   - options ...exec.ProcessOption
+func (_e *MockCapableContainer_Expecter) Exec(ctx interface{}, cmd interface{}, options ...interface{}) *MockCapableContainer_Exec_Call {
+	return &MockCapableContainer_Exec_Call{Call: _e.mock.On("Exec",
+		append([]interface{}{ctx, cmd}, options...)...)}
+}
+
+func (_c *MockCapableContainer_Exec_Call) Run(run func(ctx context.Context, cmd []string, options ...exec.ProcessOption)) *MockCapableContainer_Exec_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 []string
+		if args[1] != nil {
+			arg1 = args[1].([]string)
+		}
+		var arg2 []exec.ProcessOption
+		var variadicArgs []exec.ProcessOption
+		if len(args) > 2 {
+			variadicArgs = args[2].([]exec.ProcessOption)
+		}
+		arg2 = variadicArgs
+		run(
+			arg0,
+			arg1,
+			arg2...,
+		)
+	})
+	return _c
+}
+
+func (_c *MockCapableContainer_Exec_Call) Return(n int, reader io.Reader, err error) *MockCapableContainer_Exec_Call {
+	_c.Call.Return(n, reader, err)
+	return _c
+}
+
+func (_c *MockCapableContainer_Exec_Call) RunAndReturn(run func(ctx context.Context, cmd []string, options ...exec.ProcessOption) (int, io.Reader, error)) *MockCapableContainer_Exec_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Logs provides a mock function for the type MockCapableContainer
+func (_mock *MockCapableContainer) Logs(ctx context.Context) (io.ReadCloser, error) {
+	ret := _mock.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Logs")
+	}
+
+	var r0 io.ReadCloser
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context) (io.ReadCloser, error)); ok {
+		return returnFunc(ctx)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context) io.ReadCloser); ok {
+		r0 = returnFunc(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(io.ReadCloser)
+		}
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = returnFunc(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockCapableContainer_Logs_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Logs'
+type MockCapableContainer_Logs_Call struct {
+	*mock.Call
+}
+
+// Logs is a helper method to define mock.On call
+//   - ctx context.Context
+func (_e *MockCapableContainer_Expecter) Logs(ctx interface{}) *MockCapableContainer_Logs_Call {
+	return &MockCapableContainer_Logs_Call{Call: _e.mock.On("Logs", ctx)}
+}
+
+func (_c *MockCapableContainer_Logs_Call) Run(run func(ctx context.Context)) *MockCapableContainer_Logs_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		run(
+			arg0,
+		)
+	})
+	return _c
+}
+
+func (_c *MockCapableContainer_Logs_Call) Return(readCloser io.ReadCloser, err error) *MockCapableContainer_Logs_Call {
+	_c.Call.Return(readCloser, err)
+	return _c
+}
+
+func (_c *MockCapableContainer_Logs_Call) RunAndReturn(run func(ctx context.Context) (io.ReadCloser, error)) *MockCapableContainer_Logs_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// PortEndpoint provides a mock function for the type MockCapableContainer
+func (_mock *MockCapableContainer) PortEndpoint(ctx context.Context, port nat.Port, proto string) (string, error) {
+	ret := _mock.Called(ctx, port, proto)
+
+	if len(ret) == 0 {
+		panic("no return value specified for PortEndpoint")
+	}
+
+	var r0 string
+	var r1 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, nat.Port, string) (string, error)); ok {
+		return returnFunc(ctx, port, proto)
+	}
+	if returnFunc, ok := ret.Get(0).(func(context.Context, nat.Port, string) string); ok {
+		r0 = returnFunc(ctx, port, proto)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+	if returnFunc, ok := ret.Get(1).(func(context.Context, nat.Port, string) error); ok {
+		r1 = returnFunc(ctx, port, proto)
+	} else {
+		r1 = ret.Error(1)
+	}
+	return r0, r1
+}
+
+// MockCapableContainer_PortEndpoint_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'PortEndpoint'
+type MockCapableContainer_PortEndpoint_Call struct {
+	*mock.Call
+}
+
+// PortEndpoint is a helper method to define mock.On call
+//   - ctx context.Context
+//   - port nat.Port
+//   - proto string
+func (_e *MockCapableContainer_Expecter) PortEndpoint(ctx interface{}, port interface{}, proto interface{}) *MockCapableContainer_PortEndpoint_Call {
+	return &MockCapableContainer_PortEndpoint_Call{Call: _e.mock.On("PortEndpoint", ctx, port, proto)}
+}
+
+func (_c *MockCapableContainer_PortEndpoint_Call) Run(run func(ctx context.Context, port nat.Port, proto string)) *MockCapableContainer_PortEndpoint_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 nat.Port
+		if args[1] != nil {
+			arg1 = args[1].(nat.Port)
+		}
+		var arg2 string
+		if args[2] != nil {
+			arg2 = args[2].(string)
+		}
+		run(
+			arg0,
+			arg1,
+			arg2,
+		)
+	})
+	return _c
+}
+
+func (_c *MockCapableContainer_PortEndpoint_Call) Return(s string, err error) *MockCapableContainer_PortEndpoint_Call {
+	_c.Call.Return(s, err)
+	return _c
+}
+
+func (_c *MockCapableContainer_PortEndpoint_Call) RunAndReturn(run func(ctx context.Context, port nat.Port, proto string) (string, error)) *MockCapableContainer_PortEndpoint_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
+// Terminate provides a mock function for the type MockCapableContainer
+func (_mock *MockCapableContainer) Terminate(ctx context.Context, opts ...testcontainers.TerminateOption) error {
+	var tmpRet mock.Arguments
+	if len(opts) > 0 {
+		tmpRet = _mock.Called(ctx, opts)
+	} else {
+		tmpRet = _mock.Called(ctx)
+	}
+	ret := tmpRet
+
+	if len(ret) == 0 {
+		panic("no return value specified for Terminate")
+	}
+
+	var r0 error
+	if returnFunc, ok := ret.Get(0).(func(context.Context, ...testcontainers.TerminateOption) error); ok {
+		r0 = returnFunc(ctx, opts...)
+	} else {
+		r0 = ret.Error(0)
+	}
+	return r0
+}
+
+// MockCapableContainer_Terminate_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Terminate'
+type MockCapableContainer_Terminate_Call struct {
+	*mock.Call
+}
+
+// Terminate is a helper method to define mock.On call
+//   - ctx context.Context
+//   - opts ...testcontainers.TerminateOption
+func (_e *MockCapableContainer_Expecter) Terminate(ctx interface{}, opts ...interface{}) *MockCapableContainer_Terminate_Call {
+	return &MockCapableContainer_Terminate_Call{Call: _e.mock.On("Terminate",
+		append([]interface{}{ctx}, opts...)...)}
+}
+
+func (_c *MockCapableContainer_Terminate_Call) Run(run func(ctx context.Context, opts ...testcontainers.TerminateOption)) *MockCapableContainer_Terminate_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 context.Context
+		if args[0] != nil {
+			arg0 = args[0].(context.Context)
+		}
+		var arg1 []testcontainers.TerminateOption
+		var variadicArgs []testcontainers.TerminateOption
+		if len(args) > 1 {
+			variadicArgs = args[1].([]testcontainers.TerminateOption)
+		}
+		arg1 = variadicArgs
+		run(
+			arg0,
+			arg1...,
+		)
+	})
+	return _c
+}
+
+func (_c *MockCapableContainer_Terminate_Call) Return(err error) *MockCapableContainer_Terminate_Call {
+	_c.Call.Return(err)
+	return _c
+}
+
+func (_c *MockCapableContainer_Terminate_Call) RunAndReturn(run func(ctx context.Context, opts ...testcontainers.TerminateOption) error) *MockCapableContainer_Terminate_Call {
+	_c.Call.Return(run)
+	return _c
+}
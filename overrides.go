@@ -0,0 +1,110 @@
+package groclick
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// WithSettings sets clickhouse settings for every injected connection and for connections used by migrator.
+func WithSettings(settings clickhouse.Settings) Option {
+	return func(c *config) {
+		c.settings = maps.Clone(settings)
+	}
+}
+
+// WithTestSettings resolves clickhouse settings of test when databases are leased for it and attaches them to
+// injected connections. With database per test isolation settings are applied to migrations too, other
+// isolation modes open dedicated connection to already migrated database.
+func WithTestSettings(settings func(t *testing.T) clickhouse.Settings) Option {
+	return func(c *config) {
+		c.testSettings = settings
+	}
+}
+
+// settingsOf resolves settings of test once, they are kept by forker until test is done.
+func (f *forker) settingsOf(t *testing.T) clickhouse.Settings {
+	if f.testSettings == nil {
+		return nil
+	}
+
+	f.mu.Lock()
+	settings, ok := f.leased[t]
+	f.mu.Unlock()
+
+	if ok {
+		return settings
+	}
+
+	settings = maps.Clone(f.testSettings(t))
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if leased, ok := f.leased[t]; ok {
+		return leased
+	}
+
+	if f.leased == nil {
+		f.leased = make(map[*testing.T]clickhouse.Settings)
+	}
+
+	f.leased[t] = settings
+
+	t.Cleanup(func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		delete(f.leased, t)
+	})
+
+	return settings
+}
+
+func mergeSettings(base clickhouse.Settings, overrides ...clickhouse.Settings) clickhouse.Settings {
+	res := maps.Clone(base)
+
+	for _, override := range overrides {
+		if len(override) == 0 {
+			continue
+		}
+
+		if res == nil {
+			res = make(clickhouse.Settings, len(override))
+		}
+
+		maps.Copy(res, override)
+	}
+
+	return res
+}
+
+func (f *forker) withTestSettings(t *testing.T, dbs forkedDatabases) forkedDatabases {
+	t.Helper()
+
+	settings := f.settingsOf(t)
+	if len(settings) == 0 {
+		return dbs
+	}
+
+	res := make(forkedDatabases, 0, len(dbs))
+
+	for _, db := range dbs {
+		cfg := *db.cfg
+		cfg.Settings = mergeSettings(db.cfg.Settings, settings)
+
+		con, err := f.connConstructor(&cfg)
+		require.NoError(t, err)
+
+		t.Cleanup(func() {
+			_ = con.Close()
+		})
+
+		db.cfg, db.conn = &cfg, con
+		res = append(res, db)
+	}
+
+	return res
+}
@@ -0,0 +1,123 @@
+package groclick
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeSettings(t *testing.T) {
+	base := clickhouse.Settings{"mutations_sync": 1}
+
+	res := mergeSettings(base, nil, clickhouse.Settings{"mutations_sync": 2, "insert_quorum": 2})
+
+	assert.Equal(t, clickhouse.Settings{"mutations_sync": 2, "insert_quorum": 2}, res)
+	assert.Equal(t, clickhouse.Settings{"mutations_sync": 1}, base)
+	assert.Nil(t, mergeSettings(nil))
+}
+
+func TestSettingsOverrides(t *testing.T) {
+	t.Run("should be able to apply settings to migrator and injected connection", func(t *testing.T) {
+		root := NewMockConn(t)
+		conn := NewMockConn(t)
+
+		var opened, migrated clickhouse.Settings
+
+		fork := newForker(t.Context(), root, isolationDSN, "", config{
+			runID:    "run",
+			settings: clickhouse.Settings{"mutations_sync": 2},
+			testSettings: func(t *testing.T) clickhouse.Settings {
+				return clickhouse.Settings{"allow_experimental_object_type": 1}
+			},
+			connConstructor: func(opt *clickhouse.Options) (driver.Conn, error) {
+				opened = opt.Settings
+				return conn, nil
+			},
+			migrator: func(ctx context.Context, migratorConfig MigratorConfig) error {
+				migrated = migratorConfig.Config.Settings
+				return nil
+			},
+		})
+
+		root.EXPECT().Exec(mock.Anything, mock.Anything).Return(nil)
+		conn.EXPECT().Ping(mock.Anything).Return(nil)
+
+		cfg := newIsolator(config{}, fork, false).lease(t).primary().cfg
+
+		exp := clickhouse.Settings{"mutations_sync": 2, "allow_experimental_object_type": 1}
+		assert.Equal(t, exp, cfg.Settings)
+		assert.Equal(t, exp, opened)
+		assert.Equal(t, exp, migrated)
+	})
+
+	t.Run("should be able to open dedicated connection for shared database", func(t *testing.T) {
+		root := NewMockConn(t)
+		shared := NewMockConn(t)
+		dedicated := NewMockConn(t)
+		calls := 0
+
+		fork := newForker(t.Context(), root, isolationDSN, "", config{
+			runID: "run",
+			testSettings: func(t *testing.T) clickhouse.Settings {
+				if strings.HasSuffix(t.Name(), "with_settings") {
+					return clickhouse.Settings{"insert_quorum": 2}
+				}
+				return nil
+			},
+			connConstructor: func(opt *clickhouse.Options) (driver.Conn, error) {
+				calls++
+				if calls == 1 {
+					return shared, nil
+				}
+				assert.Equal(t, clickhouse.Settings{"insert_quorum": 2}, opt.Settings)
+				return dedicated, nil
+			},
+			migrator: func(ctx context.Context, migratorConfig MigratorConfig) error {
+				return nil
+			},
+		})
+
+		root.EXPECT().Exec(mock.Anything, mock.Anything).Return(nil)
+		shared.EXPECT().Ping(mock.Anything).Return(nil)
+		dedicated.EXPECT().Close().Return(nil)
+
+		iso := newIsolator(config{isolation: IsolationShared}, fork, false)
+
+		first := iso.lease(t).primary()
+		assert.Same(t, shared, first.conn)
+
+		t.Run("with settings", func(t *testing.T) {
+			second := iso.lease(t).primary()
+			require.Same(t, dedicated, second.conn)
+			assert.Equal(t, clickhouse.Settings{"insert_quorum": 2}, second.cfg.Settings)
+		})
+	})
+
+	t.Run("should be able to resolve settings once per test and forget them after test", func(t *testing.T) {
+		resolved := 0
+
+		fork := newForker(t.Context(), NewMockConn(t), isolationDSN, "", config{
+			runID: "run",
+			testSettings: func(t *testing.T) clickhouse.Settings {
+				resolved++
+				return clickhouse.Settings{"insert_quorum": 2}
+			},
+		})
+
+		t.Run("leased", func(t *testing.T) {
+			exp := clickhouse.Settings{"insert_quorum": 2}
+			assert.Equal(t, exp, fork.settingsOf(t))
+			assert.Equal(t, exp, fork.settingsOf(t))
+			assert.Len(t, fork.leased, 1)
+		})
+
+		assert.Equal(t, 1, resolved)
+		assert.Empty(t, fork.leased)
+	})
+}
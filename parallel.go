@@ -0,0 +1,50 @@
+package groclick
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// forkLimiter bounds number of databases created and migrated at the same time, nil limiter is unbounded.
+type forkLimiter chan struct{}
+
+// WithMaxConcurrentForks limits number of tests creating and migrating databases at the same time, so
+// parallel tests don't exceed max_concurrent_queries of ClickHouse server. Zero means no limit.
+func WithMaxConcurrentForks(limit int) Option {
+	return func(c *config) {
+		c.maxConcurrentForks = limit
+	}
+}
+
+func newForkLimiter(limit int) forkLimiter {
+	if limit <= 0 {
+		return nil
+	}
+
+	return make(forkLimiter, limit)
+}
+
+func (l forkLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l <- struct{}{}:
+		return func() { <-l }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("can't wait for fork slot: %w", ctx.Err())
+	}
+}
+
+// testContext keeps values of bootstrap context and is cancelled when either bootstrap or test is done.
+func testContext(ctx context.Context, t *testing.T) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(t.Context(), cancel)
+
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
@@ -0,0 +1,167 @@
+package groclick
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForker_Parallel(t *testing.T) {
+	const (
+		tests = 32
+		limit = 3
+	)
+
+	root := NewMockConn(t)
+	conn := NewMockConn(t)
+
+	var (
+		active  atomic.Int32
+		peak    atomic.Int32
+		mu      sync.Mutex
+		created = make(map[string]struct{}, tests)
+	)
+
+	cfg := config{
+		runID:              "run",
+		maxConcurrentForks: limit,
+		migrator: func(ctx context.Context, cfg MigratorConfig) error {
+			current := active.Add(1)
+			defer active.Add(-1)
+
+			for {
+				seen := peak.Load()
+				if current <= seen || peak.CompareAndSwap(seen, current) {
+					break
+				}
+			}
+
+			select {
+			case <-time.After(time.Millisecond):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			return nil
+		},
+		connConstructor: func(opt *clickhouse.Options) (driver.Conn, error) {
+			return conn, nil
+		},
+	}
+
+	fork := newForker(t.Context(), root, isolationDSN, "", cfg)
+	isolation := newIsolator(cfg, fork, false)
+
+	root.EXPECT().Exec(mock.Anything, mock.Anything).Return(nil).Times(tests)
+	conn.EXPECT().Ping(mock.Anything).Return(nil).Times(tests)
+
+	t.Run("Parallel", func(t *testing.T) {
+		for i := range tests {
+			t.Run(fmt.Sprintf("Case %d", i), func(t *testing.T) {
+				t.Parallel()
+
+				name := isolation.lease(t).primary().cfg.Auth.Database
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				created[name] = struct{}{}
+			})
+		}
+	})
+
+	assert.Len(t, created, tests)
+	assert.Equal(t, limit, cap(fork.limiter))
+	assert.Empty(t, fork.limiter, "all fork slots are released")
+	assert.Positive(t, peak.Load())
+	assert.LessOrEqual(t, peak.Load(), int32(cap(fork.limiter)))
+}
+
+func TestForkLimiter(t *testing.T) {
+	t.Run("should be able to acquire without limit", func(t *testing.T) {
+		release, err := newForkLimiter(0).acquire(t.Context())
+		require.NoError(t, err)
+		release()
+	})
+
+	t.Run("should be able to hold forks above limit until release", func(t *testing.T) {
+		limiter := newForkLimiter(2)
+
+		first, err := limiter.acquire(t.Context())
+		require.NoError(t, err)
+
+		second, err := limiter.acquire(t.Context())
+		require.NoError(t, err)
+		defer second()
+
+		ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err = limiter.acquire(ctx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		first()
+
+		third, err := limiter.acquire(t.Context())
+		require.NoError(t, err)
+		third()
+	})
+
+	t.Run("should be able failed when context is done", func(t *testing.T) {
+		limiter := newForkLimiter(1)
+
+		release, err := limiter.acquire(t.Context())
+		require.NoError(t, err)
+		defer release()
+
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+
+		_, err = limiter.acquire(ctx)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestTestContext(t *testing.T) {
+	t.Run("should be able to cancel by bootstrap context", func(t *testing.T) {
+		type key struct{}
+
+		parent, cancelParent := context.WithCancel(context.WithValue(t.Context(), key{}, "value"))
+
+		ctx, cancel := testContext(parent, t)
+		defer cancel()
+
+		assert.Equal(t, "value", ctx.Value(key{}))
+		require.NoError(t, ctx.Err())
+
+		cancelParent()
+		require.ErrorIs(t, ctx.Err(), context.Canceled)
+	})
+
+	t.Run("should be able to cancel by test context", func(t *testing.T) {
+		var ctx context.Context
+
+		t.Run("Case", func(t *testing.T) {
+			ctx, _ = testContext(context.Background(), t)
+
+			require.NoError(t, ctx.Err())
+		})
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			require.FailNow(t, "context is not cancelled when test is done")
+		}
+
+		require.ErrorIs(t, ctx.Err(), context.Canceled)
+	})
+}
@@ -0,0 +1,200 @@
+package groclick
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+const (
+	defaultStartupTimeout      = 2 * time.Minute
+	defaultReadinessBackoff    = 100 * time.Millisecond
+	defaultReadinessMaxBackoff = 2 * time.Second
+	defaultLogTail             = 50
+)
+
+var (
+	ErrNotReady       = errors.New("clickhouse is not ready")
+	ErrStartupTimeout = errors.New("clickhouse container startup timeout")
+)
+
+type (
+	ReadinessProbe func(ctx context.Context, conn driver.Conn) error
+
+	systemTablesCount struct {
+		Tables uint64 `ch:"tables"`
+	}
+)
+
+// WithStartupTimeout bounds container start and readiness probes together, probes get time remaining
+// after container started.
+func WithStartupTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.startupTimeout = timeout
+	}
+}
+
+// WithReadinessProbes replaces default probes (ping and system.tables query) which should pass before
+// container considered ready.
+func WithReadinessProbes(probes ...ReadinessProbe) Option {
+	return func(c *config) {
+		c.readinessProbes = probes
+	}
+}
+
+func WithReadinessBackoff(initial, maxBackoff time.Duration) Option {
+	return func(c *config) {
+		c.readinessBackoff = initial
+		c.readinessMaxBackoff = maxBackoff
+	}
+}
+
+// WithLogTail sets how many container log lines are reported when bootstrap failed, zero disables report.
+func WithLogTail(lines int) Option {
+	return func(c *config) {
+		c.logTail = lines
+	}
+}
+
+func PingProbe() ReadinessProbe {
+	return func(ctx context.Context, conn driver.Conn) error {
+		if err := conn.Ping(ctx); err != nil {
+			return fmt.Errorf("can't ping: %w", err)
+		}
+
+		return nil
+	}
+}
+
+func SystemTablesProbe() ReadinessProbe {
+	return func(ctx context.Context, conn driver.Conn) error {
+		var res []systemTablesCount
+
+		if err := conn.Select(ctx, &res, "SELECT count() AS tables FROM system.tables"); err != nil {
+			return fmt.Errorf("can't query system.tables: %w", err)
+		}
+
+		return nil
+	}
+}
+
+func SQLProbe(query string) ReadinessProbe {
+	return func(ctx context.Context, conn driver.Conn) error {
+		if err := conn.Exec(ctx, query); err != nil {
+			return fmt.Errorf("probe %q failed: %w", query, err)
+		}
+
+		return nil
+	}
+}
+
+// startupContext bounds container start with timeout, but doesn't limit lifetime of container background
+// routines, like log producers, which inherit returned context.
+func startupContext(ctx context.Context, timeout time.Duration) (context.Context, func()) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+
+	runCtx, cancel := context.WithCancelCause(ctx)
+	timer := time.AfterFunc(timeout, func() {
+		cancel(ErrStartupTimeout)
+	})
+
+	return runCtx, func() {
+		timer.Stop()
+	}
+}
+
+func waitReady(ctx context.Context, conn driver.Conn, cfg config) error {
+	if len(cfg.readinessProbes) == 0 {
+		return nil
+	}
+
+	if !cfg.startupDeadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, cfg.startupDeadline)
+		defer cancel()
+	}
+
+	backoff := cfg.readinessBackoff
+	if backoff <= 0 {
+		backoff = defaultReadinessBackoff
+	}
+
+	maxBackoff := max(cfg.readinessMaxBackoff, backoff)
+
+	for attempt := 1; ; attempt++ {
+		err := runProbes(ctx, conn, cfg.readinessProbes)
+		if err == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w after %d attempts: %w", ErrNotReady, attempt, err)
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func runProbes(ctx context.Context, conn driver.Conn, probes []ReadinessProbe) error {
+	for _, probe := range probes {
+		if err := probe(ctx, conn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func withLogTail(ctx context.Context, click ClickhouseContainer, lines int, err error) error {
+	if lines <= 0 {
+		return err
+	}
+
+	tail, logErr := containerLogTail(ctx, click, lines)
+	if logErr != nil {
+		return fmt.Errorf("%w\n(can't read container logs: %w)", err, logErr)
+	}
+
+	return fmt.Errorf("%w\nlast container logs:\n%s", err, tail)
+}
+
+func containerLogTail(ctx context.Context, click ClickhouseContainer, lines int) (string, error) {
+	reader, ok := click.(containerLogsReader)
+	if !ok {
+		return "", fmt.Errorf("%w logs", ErrUnsupportedContainer)
+	}
+
+	logs, err := reader.Logs(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	defer func() {
+		_ = logs.Close()
+	}()
+
+	tail := make([]string, 0, lines)
+	scanner := bufio.NewScanner(logs)
+
+	for scanner.Scan() {
+		if len(tail) == lines {
+			tail = tail[1:]
+		}
+		tail = append(tail, scanner.Text())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return strings.Join(tail, "\n"), nil
+}
@@ -0,0 +1,156 @@
+package groclick
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+const systemTablesQuery = "SELECT count() AS tables FROM system.tables"
+
+func TestWaitReady(t *testing.T) {
+	t.Run("should be able to retry until probes pass", func(t *testing.T) {
+		conn := NewMockConn(t)
+		calls := atomic.Int32{}
+
+		conn.EXPECT().Ping(mock.Anything).RunAndReturn(func(ctx context.Context) error {
+			if calls.Add(1) < 3 {
+				return assert.AnError
+			}
+			return nil
+		})
+		conn.EXPECT().Select(mock.Anything, mock.Anything, systemTablesQuery).Return(nil)
+		conn.EXPECT().Exec(mock.Anything, "SELECT 1").Return(nil)
+
+		require.NoError(t, waitReady(t.Context(), conn, config{
+			startupDeadline:  time.Now().Add(time.Second),
+			readinessBackoff: time.Millisecond,
+			readinessProbes:  []ReadinessProbe{PingProbe(), SystemTablesProbe(), SQLProbe("SELECT 1")},
+		}))
+		assert.Equal(t, int32(3), calls.Load())
+	})
+
+	t.Run("should be able to skip when no probes configured", func(t *testing.T) {
+		require.NoError(t, waitReady(t.Context(), NewMockConn(t), config{}))
+	})
+
+	t.Run("should be able to fail on startup timeout", func(t *testing.T) {
+		conn := NewMockConn(t)
+		exp := errors.New(uuid.NewString())
+
+		conn.EXPECT().Select(mock.Anything, mock.Anything, systemTablesQuery).Return(exp)
+
+		err := waitReady(t.Context(), conn, config{
+			startupDeadline:     time.Now().Add(10 * time.Millisecond),
+			readinessBackoff:    time.Millisecond,
+			readinessMaxBackoff: 2 * time.Millisecond,
+			readinessProbes:     []ReadinessProbe{SystemTablesProbe()},
+		})
+		require.ErrorIs(t, err, ErrNotReady)
+		require.ErrorIs(t, err, exp)
+	})
+
+	t.Run("should be able to stop when startup deadline spent by container start", func(t *testing.T) {
+		conn := NewMockConn(t)
+
+		conn.EXPECT().Ping(mock.Anything).Return(assert.AnError).Once()
+
+		err := waitReady(t.Context(), conn, config{
+			startupTimeout:   time.Hour,
+			startupDeadline:  time.Now().Add(-time.Millisecond),
+			readinessBackoff: time.Hour,
+			readinessProbes:  []ReadinessProbe{PingProbe()},
+		})
+		require.ErrorIs(t, err, ErrNotReady)
+		assert.Contains(t, err.Error(), "after 1 attempts")
+	})
+}
+
+func TestContainerLogTail(t *testing.T) {
+	t.Run("should be able to keep last lines", func(t *testing.T) {
+		cont := NewMockCapableContainer(t)
+
+		cont.EXPECT().Logs(mock.Anything).Return(io.NopCloser(strings.NewReader("one\ntwo\nthree\n")), nil)
+
+		err := withLogTail(t.Context(), cont, 2, assert.AnError)
+		require.ErrorIs(t, err, assert.AnError)
+		assert.Contains(t, err.Error(), "last container logs:\ntwo\nthree")
+		assert.NotContains(t, err.Error(), "one")
+	})
+
+	t.Run("should be able to report when logs are unavailable", func(t *testing.T) {
+		cont := NewMockCapableContainer(t)
+		exp := errors.New(uuid.NewString())
+
+		cont.EXPECT().Logs(mock.Anything).Return(nil, exp)
+
+		err := withLogTail(t.Context(), cont, 2, assert.AnError)
+		require.ErrorIs(t, err, assert.AnError)
+		assert.Contains(t, err.Error(), exp.Error())
+	})
+
+	t.Run("should be able to report when container can't read logs", func(t *testing.T) {
+		err := withLogTail(t.Context(), NewMockClickhouseContainer(t), 2, assert.AnError)
+		require.ErrorIs(t, err, assert.AnError)
+		require.ErrorIs(t, err, ErrUnsupportedContainer)
+	})
+
+	t.Run("should be able to skip when disabled", func(t *testing.T) {
+		assert.Equal(t, assert.AnError, withLogTail(t.Context(), NewMockClickhouseContainer(t), 0, assert.AnError))
+	})
+}
+
+func TestBootstrapper_NotReady(t *testing.T) {
+	cont := NewMockCapableContainer(t)
+	conn := NewMockConn(t)
+
+	cont.EXPECT().ConnectionString(mock.Anything).Return("clickhouse://localhost:9000/default", nil)
+	cont.EXPECT().Logs(mock.Anything).Return(io.NopCloser(strings.NewReader("Code: 210. DB::Exception\n")), nil)
+	cont.EXPECT().Terminate(mock.Anything).Return(nil).Maybe()
+	conn.EXPECT().Ping(mock.Anything).Return(assert.AnError)
+
+	_, err := bootstrapper[Deps](config{
+		startupTimeout:   10 * time.Millisecond,
+		readinessBackoff: time.Millisecond,
+		readinessProbes:  []ReadinessProbe{PingProbe()},
+		logTail:          defaultLogTail,
+		migrator: func(ctx context.Context, migratorConfig MigratorConfig) error {
+			return nil
+		},
+		connConstructor: func(opt *clickhouse.Options) (driver.Conn, error) {
+			return conn, nil
+		},
+		runner: func(
+			ctx context.Context,
+			img string,
+			opts ...testcontainers.ContainerCustomizer,
+		) (ClickhouseContainer, error) {
+			return cont, nil
+		},
+	})(t.Context())
+	require.ErrorIs(t, err, ErrNotReady)
+	assert.Contains(t, err.Error(), "DB::Exception")
+}
+
+func TestStartupContext(t *testing.T) {
+	ctx, started := startupContext(t.Context(), time.Millisecond)
+	<-ctx.Done()
+	started()
+	require.ErrorIs(t, context.Cause(ctx), ErrStartupTimeout)
+
+	ctx, started = startupContext(t.Context(), time.Hour)
+	started()
+	require.NoError(t, ctx.Err())
+}
@@ -0,0 +1,273 @@
+package groclick
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	dockernetwork "github.com/docker/docker/api/types/network"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+const (
+	LabelSession      = "org.godepo.groclick.session"
+	LabelHost         = "org.godepo.groclick.host"
+	LabelPID          = "org.godepo.groclick.pid"
+	LabelBoot         = "org.godepo.groclick.boot"
+	LabelPIDNamespace = "org.godepo.groclick.pidns"
+
+	ResourceContainer = "container"
+	ResourceNetwork   = "network"
+
+	ryukDisabledEnv  = "TESTCONTAINERS_RYUK_DISABLED"
+	bootIDPath       = "/proc/sys/kernel/random/boot_id"
+	pidNamespacePath = "/proc/self/ns/pid"
+)
+
+type (
+	// SweptResource is container or network removed by sweeper, because process which started it is gone.
+	SweptResource struct {
+		ID      string
+		Kind    string
+		Session string
+		PID     int
+	}
+
+	dockerResource struct {
+		ID     string
+		Kind   string
+		Labels map[string]string
+	}
+
+	// orphanSweeper removes resources labeled by groclick processes of this host which no longer exist. Process
+	// IDs are compared only within the same boot and PID namespace, where they identify the same process.
+	orphanSweeper struct {
+		host   string
+		boot   string
+		pidns  string
+		list   func(ctx context.Context) ([]dockerResource, error)
+		remove func(ctx context.Context, resource dockerResource) error
+		alive  func(pid int) bool
+	}
+)
+
+// WithoutRyuk disables Ryuk reaper of testcontainers for runners forbidding privileged containers. Containers
+// and networks are labeled with run session, host, boot, PID namespace and process ID instead, and resources
+// left by killed test processes are removed at bootstrap. It must be applied before any container of test
+// binary is started. Resources are never swept on systems without procfs, where boot and namespace are unknown.
+func WithoutRyuk() Option {
+	return func(c *config) {
+		c.withoutRyuk = true
+	}
+}
+
+// SweepOrphanedContainers removes containers and networks labeled by groclick processes of this host, boot
+// and PID namespace which no longer exist.
+func SweepOrphanedContainers(ctx context.Context) ([]SweptResource, error) {
+	return newDockerSweeper().sweep(ctx)
+}
+
+func newDockerSweeper() *orphanSweeper {
+	return &orphanSweeper{
+		host:   hostname(),
+		boot:   bootID(),
+		pidns:  pidNamespaceID(),
+		list:   listDockerResources,
+		remove: removeDockerResource,
+		alive:  processAlive,
+	}
+}
+
+func (s *orphanSweeper) sweep(ctx context.Context) ([]SweptResource, error) {
+	resources, err := s.list(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can't list labeled resources: %w", err)
+	}
+
+	swept := make([]SweptResource, 0)
+	errs := make([]error, 0)
+
+	// containers are removed before networks they are attached to
+	for _, kind := range []string{ResourceContainer, ResourceNetwork} {
+		for _, resource := range resources {
+			if resource.Kind != kind || !s.owns(resource) {
+				continue
+			}
+
+			pid, err := strconv.Atoi(resource.Labels[LabelPID])
+			if err != nil || pid == os.Getpid() || s.alive(pid) {
+				continue
+			}
+
+			if err := s.remove(ctx, resource); err != nil {
+				errs = append(errs, fmt.Errorf("can't remove orphaned %s %s: %w", resource.Kind, resource.ID, err))
+
+				continue
+			}
+
+			swept = append(swept, SweptResource{
+				ID:      resource.ID,
+				Kind:    resource.Kind,
+				Session: resource.Labels[LabelSession],
+				PID:     pid,
+			})
+		}
+	}
+
+	return swept, errors.Join(errs...)
+}
+
+// owns reports whether resource is labeled by process of the same host, boot and PID namespace.
+func (s *orphanSweeper) owns(resource dockerResource) bool {
+	if s.boot == "" || s.pidns == "" {
+		return false
+	}
+
+	return resource.Labels[LabelHost] == s.host &&
+		resource.Labels[LabelBoot] == s.boot &&
+		resource.Labels[LabelPIDNamespace] == s.pidns
+}
+
+func (c config) sessionLabels() map[string]string {
+	if !c.withoutRyuk {
+		return nil
+	}
+
+	return map[string]string{
+		LabelSession:      c.runID,
+		LabelHost:         hostname(),
+		LabelPID:          strconv.Itoa(os.Getpid()),
+		LabelBoot:         bootID(),
+		LabelPIDNamespace: pidNamespaceID(),
+	}
+}
+
+// reapAtBootstrap disables Ryuk and sweeps resources of dead processes.
+func reapAtBootstrap(ctx context.Context, cfg config) error {
+	if !cfg.withoutRyuk {
+		return nil
+	}
+
+	if _, ok := os.LookupEnv(ryukDisabledEnv); !ok {
+		if err := os.Setenv(ryukDisabledEnv, "true"); err != nil {
+			return fmt.Errorf("can't disable ryuk: %w", err)
+		}
+	}
+
+	sweeper := cfg.orphanSweeper
+	if sweeper == nil {
+		sweeper = newDockerSweeper()
+	}
+
+	swept, err := sweeper.sweep(ctx)
+
+	for _, resource := range swept {
+		cfg.log().Info("orphaned resource swept",
+			slog.String("kind", resource.Kind),
+			slog.String("id", resource.ID),
+			slog.String("session", resource.Session),
+			slog.Int("pid", resource.PID),
+		)
+	}
+
+	return err
+}
+
+func listDockerResources(ctx context.Context) ([]dockerResource, error) {
+	cli, err := testcontainers.NewDockerClientWithOpts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		_ = cli.Close()
+	}()
+
+	labeled := filters.NewArgs(filters.Arg("label", LabelPID))
+
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true, Filters: labeled})
+	if err != nil {
+		return nil, err
+	}
+
+	networks, err := cli.NetworkList(ctx, dockernetwork.ListOptions{Filters: labeled})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]dockerResource, 0, len(containers)+len(networks))
+	for _, c := range containers {
+		res = append(res, dockerResource{ID: c.ID, Kind: ResourceContainer, Labels: c.Labels})
+	}
+
+	for _, n := range networks {
+		res = append(res, dockerResource{ID: n.ID, Kind: ResourceNetwork, Labels: n.Labels})
+	}
+
+	return res, nil
+}
+
+func removeDockerResource(ctx context.Context, resource dockerResource) error {
+	cli, err := testcontainers.NewDockerClientWithOpts(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = cli.Close()
+	}()
+
+	if resource.Kind == ResourceNetwork {
+		return cli.NetworkRemove(ctx, resource.ID)
+	}
+
+	return cli.ContainerRemove(ctx, resource.ID, container.RemoveOptions{Force: true, RemoveVolumes: true})
+}
+
+// processAlive reports whether process exists, process which can't be signalled is considered alive.
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	err = process.Signal(syscall.Signal(0))
+
+	return err == nil || !errors.Is(err, os.ErrProcessDone) && !errors.Is(err, syscall.ESRCH)
+}
+
+// bootID is empty when it can't be read, so resources are never swept by sweeper without it.
+func bootID() string {
+	data, err := os.ReadFile(bootIDPath)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(data))
+}
+
+// pidNamespaceID returns link of PID namespace like pid:[4026531836], it is empty when it can't be read.
+func pidNamespaceID() string {
+	link, err := os.Readlink(pidNamespacePath)
+	if err != nil {
+		return ""
+	}
+
+	return link
+}
+
+func hostname() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+
+	return host
+}
@@ -0,0 +1,159 @@
+package groclick
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestOrphanSweeper(t *testing.T) {
+	labels := func(host, boot, pidns, pid string) map[string]string {
+		return map[string]string{
+			LabelSession:      "run",
+			LabelHost:         host,
+			LabelBoot:         boot,
+			LabelPIDNamespace: pidns,
+			LabelPID:          pid,
+		}
+	}
+
+	resources := []dockerResource{
+		{ID: "net", Kind: ResourceNetwork, Labels: labels("host", "boot", "pidns", "10")},
+		{ID: "dead", Kind: ResourceContainer, Labels: labels("host", "boot", "pidns", "10")},
+		{ID: "alive", Kind: ResourceContainer, Labels: labels("host", "boot", "pidns", "20")},
+		{ID: "own", Kind: ResourceContainer, Labels: labels("host", "boot", "pidns", strconv.Itoa(os.Getpid()))},
+		{ID: "foreign", Kind: ResourceContainer, Labels: labels("other", "boot", "pidns", "10")},
+		{ID: "rebooted", Kind: ResourceContainer, Labels: labels("host", "other", "pidns", "10")},
+		{ID: "namespaced", Kind: ResourceContainer, Labels: labels("host", "boot", "other", "10")},
+		{ID: "legacy", Kind: ResourceContainer, Labels: map[string]string{LabelHost: "host", LabelPID: "10"}},
+		{ID: "broken", Kind: ResourceContainer, Labels: labels("host", "boot", "pidns", "pid")},
+	}
+
+	newSweeper := func(removed *[]string, err error) *orphanSweeper {
+		return &orphanSweeper{
+			host:  "host",
+			boot:  "boot",
+			pidns: "pidns",
+			list: func(ctx context.Context) ([]dockerResource, error) {
+				return resources, nil
+			},
+			remove: func(ctx context.Context, resource dockerResource) error {
+				*removed = append(*removed, resource.ID)
+				return err
+			},
+			alive: func(pid int) bool {
+				return pid == 20
+			},
+		}
+	}
+
+	t.Run("should be able to remove resources of dead processes", func(t *testing.T) {
+		var removed []string
+
+		swept, err := newSweeper(&removed, nil).sweep(t.Context())
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"dead", "net"}, removed)
+		assert.Equal(t, []SweptResource{
+			{ID: "dead", Kind: ResourceContainer, Session: "run", PID: 10},
+			{ID: "net", Kind: ResourceNetwork, Session: "run", PID: 10},
+		}, swept)
+	})
+
+	t.Run("should be able to report failed removals", func(t *testing.T) {
+		var removed []string
+
+		exp := errors.New(uuid.NewString())
+
+		swept, err := newSweeper(&removed, exp).sweep(t.Context())
+		require.ErrorIs(t, err, exp)
+		assert.Empty(t, swept)
+		assert.Equal(t, []string{"dead", "net"}, removed)
+	})
+
+	t.Run("should be able to skip sweep without boot and namespace", func(t *testing.T) {
+		var removed []string
+
+		sweeper := newSweeper(&removed, nil)
+		sweeper.boot = ""
+
+		swept, err := sweeper.sweep(t.Context())
+		require.NoError(t, err)
+		assert.Empty(t, swept)
+		assert.Empty(t, removed)
+	})
+
+	t.Run("should be able failed when can't list resources", func(t *testing.T) {
+		exp := errors.New(uuid.NewString())
+		sweeper := &orphanSweeper{list: func(ctx context.Context) ([]dockerResource, error) {
+			return nil, exp
+		}}
+
+		_, err := sweeper.sweep(t.Context())
+		require.ErrorIs(t, err, exp)
+	})
+}
+
+func TestReapAtBootstrap(t *testing.T) {
+	t.Run("should be able to skip with ryuk", func(t *testing.T) {
+		require.NoError(t, reapAtBootstrap(t.Context(), config{}))
+		assert.Nil(t, config{}.sessionLabels())
+	})
+
+	t.Run("should be able to disable ryuk and sweep", func(t *testing.T) {
+		t.Setenv(ryukDisabledEnv, "")
+		require.NoError(t, os.Unsetenv(ryukDisabledEnv))
+
+		swept := false
+		cfg := config{runID: "run"}
+		WithoutRyuk()(&cfg)
+		cfg.orphanSweeper = &orphanSweeper{list: func(ctx context.Context) ([]dockerResource, error) {
+			swept = true
+			return nil, nil
+		}}
+
+		require.NoError(t, reapAtBootstrap(t.Context(), cfg))
+		assert.True(t, swept)
+		assert.Equal(t, "true", os.Getenv(ryukDisabledEnv))
+
+		labels := cfg.sessionLabels()
+		assert.Equal(t, "run", labels[LabelSession])
+		assert.Equal(t, strconv.Itoa(os.Getpid()), labels[LabelPID])
+		assert.Equal(t, hostname(), labels[LabelHost])
+		assert.Equal(t, bootID(), labels[LabelBoot])
+		assert.Equal(t, pidNamespaceID(), labels[LabelPIDNamespace])
+	})
+
+	t.Run("should be able to label companions", func(t *testing.T) {
+		var (
+			calls []string
+			req   testcontainers.GenericContainerRequest
+		)
+
+		cfg := companionConfig(&calls, func(
+			ctx context.Context,
+			r testcontainers.GenericContainerRequest,
+		) (CompanionContainer, error) {
+			req = r
+			return NewMockCompanionContainer(t), nil
+		})
+		cfg.runID = "run"
+		cfg.withoutRyuk = true
+
+		_, err := (&companions{}).run(t.Context(), cfg, "alias", testcontainers.GenericContainerRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, "run", req.Labels[LabelSession])
+	})
+}
+
+func TestProcessAlive(t *testing.T) {
+	assert.True(t, processAlive(os.Getpid()))
+	assert.False(t, processAlive(1<<30))
+}
@@ -0,0 +1,225 @@
+package groclick
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+const (
+	defaultRedpandaImage = "docker.redpanda.com/redpandadata/redpanda:v24.2.7"
+	redpandaAlias        = "groclick-redpanda"
+	redpandaKafkaPort    = nat.Port("9092/tcp")
+	redpandaProxyPort    = nat.Port("8082/tcp")
+	kafkaBinaryMediaType = "application/vnd.kafka.binary.v2+json"
+
+	VariableKafkaBroker      = "kafka_broker"
+	VariableKafkaGroup       = "kafka_group"
+	VariableKafkaTopicPrefix = "kafka_topic_"
+)
+
+var (
+	ErrUnknownTopic  = errors.New("unknown kafka topic")
+	ErrKafkaProduce  = errors.New("can't produce kafka records")
+	redpandaCommands = []string{
+		"redpanda", "start", "--mode", "dev-container", "--smp", "1",
+		"--kafka-addr", "0.0.0.0:" + redpandaKafkaPort.Port(),
+		"--advertise-kafka-addr", redpandaAlias + ":" + redpandaKafkaPort.Port(),
+		"--pandaproxy-addr", "0.0.0.0:" + redpandaProxyPort.Port(),
+	}
+)
+
+type (
+	// Kafka is set of topics created in Redpanda companion for forked database. Broker is reachable by
+	// ClickHouse server, Topics maps declared topic to topic created for database, Group is consumer group
+	// unique for database.
+	Kafka struct {
+		Broker string
+		Topics map[string]string
+		Group  string
+		proxy  string
+		client *http.Client
+	}
+
+	kafkaRecord struct {
+		Value string `json:"value"`
+	}
+
+	kafkaRecords struct {
+		Records []kafkaRecord `json:"records"`
+	}
+
+	kafkaOffset struct {
+		Partition int    `json:"partition"`
+		Offset    int64  `json:"offset"`
+		ErrorCode int    `json:"error_code"`
+		Message   string `json:"message"`
+	}
+
+	kafkaOffsets struct {
+		Offsets []kafkaOffset `json:"offsets"`
+	}
+
+	redpandaCompanion struct {
+		container CompanionContainer
+		proxy     string
+		topics    []string
+	}
+)
+
+// WithRedpanda starts Redpanda companion on network shared with ClickHouse. Topics are created for every forked
+// database and exposed to migrations by ${kafka_topic_<topic>} variables next to ${kafka_broker} and
+// ${kafka_group}, Kafka producer is injected into tests.
+func WithRedpanda(topics ...string) Option {
+	return func(c *config) {
+		if c.redpandaImage == "" {
+			c.redpandaImage = defaultRedpandaImage
+		}
+
+		c.kafkaTopics = topics
+	}
+}
+
+func WithRedpandaImage(image string) Option {
+	return func(c *config) {
+		c.redpandaImage = image
+	}
+}
+
+func WithInjectLabelForKafka(label string) Option {
+	return func(c *config) {
+		c.injectLabelForKafka = label
+	}
+}
+
+// Produce writes values as records of declared topic.
+func (k *Kafka) Produce(ctx context.Context, topic string, values ...[]byte) error {
+	name, ok := k.Topics[topic]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownTopic, topic)
+	}
+
+	records := kafkaRecords{Records: make([]kafkaRecord, 0, len(values))}
+	for _, value := range values {
+		records.Records = append(records.Records, kafkaRecord{Value: base64.StdEncoding.EncodeToString(value)})
+	}
+
+	body, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("can't encode kafka records: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.proxy+"/topics/"+url.PathEscape(name),
+		bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("can't create produce request: %w", err)
+	}
+	req.Header.Set("Content-Type", kafkaBinaryMediaType)
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrKafkaProduce, err)
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+
+		return fmt.Errorf("%w: status %d: %s", ErrKafkaProduce, resp.StatusCode, bytes.TrimSpace(data))
+	}
+
+	var offsets kafkaOffsets
+	if err := json.NewDecoder(resp.Body).Decode(&offsets); err != nil {
+		return fmt.Errorf("can't decode produce response: %w", err)
+	}
+
+	for _, offset := range offsets.Offsets {
+		if offset.ErrorCode != 0 {
+			return fmt.Errorf("%w: error code %d: %s", ErrKafkaProduce, offset.ErrorCode, offset.Message)
+		}
+	}
+
+	return nil
+}
+
+func (k *Kafka) variables() map[string]string {
+	if k == nil {
+		return nil
+	}
+
+	res := make(map[string]string, len(k.Topics)+2)
+	res[VariableKafkaBroker] = k.Broker
+	res[VariableKafkaGroup] = k.Group
+
+	for topic, name := range k.Topics {
+		res[VariableKafkaTopicPrefix+topic] = name
+	}
+
+	return res
+}
+
+func startRedpanda(ctx context.Context, cfg config, companions *companions) (*redpandaCompanion, error) {
+	container, err := companions.run(ctx, cfg, redpandaAlias, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        cfg.redpandaImage,
+			Cmd:          redpandaCommands,
+			ExposedPorts: []string{string(redpandaProxyPort)},
+			WaitingFor:   wait.ForHTTP("/topics").WithPort(redpandaProxyPort),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := container.PortEndpoint(ctx, redpandaProxyPort, "http")
+	if err != nil {
+		return nil, fmt.Errorf("can't get redpanda proxy endpoint: %w", err)
+	}
+
+	return &redpandaCompanion{
+		container: container,
+		proxy:     proxy,
+		topics:    cfg.kafkaTopics,
+	}, nil
+}
+
+// create creates declared topics prefixed by database name.
+func (r *redpandaCompanion) create(ctx context.Context, database string) (*Kafka, error) {
+	res := &Kafka{
+		Broker: redpandaAlias + ":" + redpandaKafkaPort.Port(),
+		Topics: make(map[string]string, len(r.topics)),
+		Group:  database,
+		proxy:  r.proxy,
+		client: http.DefaultClient,
+	}
+
+	if len(r.topics) == 0 {
+		return res, nil
+	}
+
+	cmd := []string{"rpk", "topic", "create"}
+	for _, topic := range r.topics {
+		name := database + "_" + sanitizeIdentifier(topic)
+		res.Topics[topic] = name
+		cmd = append(cmd, name)
+	}
+
+	if err := execCompanion(ctx, r.container, cmd...); err != nil {
+		return nil, fmt.Errorf("can't create kafka topics: %w", err)
+	}
+
+	return res, nil
+}
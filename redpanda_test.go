@@ -0,0 +1,138 @@
+package groclick
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestRedpanda(t *testing.T) {
+	var (
+		calls []string
+		req   testcontainers.GenericContainerRequest
+	)
+
+	cont := NewMockCompanionContainer(t)
+	cfg := companionConfig(&calls, func(
+		ctx context.Context,
+		r testcontainers.GenericContainerRequest,
+	) (CompanionContainer, error) {
+		req = r
+		return cont, nil
+	})
+	cfg.redpandaImage = defaultRedpandaImage
+	cfg.kafkaTopics = []string{"events"}
+	cfg.injectLabelForKafka = "clickhouse.kafka"
+
+	cont.EXPECT().PortEndpoint(mock.Anything, redpandaProxyPort, "http").Return("http://localhost:32770", nil)
+
+	comps, err := startCompanions(t.Context(), cfg)
+	require.NoError(t, err)
+	require.NotNil(t, comps.redpanda())
+
+	assert.Contains(t, req.Cmd, "groclick-redpanda:9092")
+	assert.Equal(t, []string{redpandaAlias}, req.NetworkAliases["groclick-net"])
+
+	t.Run("should be able to create topics for forked database", func(t *testing.T) {
+		root := NewMockConn(t)
+		conn := NewMockConn(t)
+
+		cont.EXPECT().Exec(mock.Anything, []string{"rpk", "topic", "create", "groclick_run_1_events"}, mock.Anything).
+			Return(0, nil, nil).Once()
+		root.EXPECT().Exec(mock.Anything, mock.Anything).Return(nil)
+		conn.EXPECT().Ping(mock.Anything).Return(nil)
+
+		fork := newForker(t.Context(), root, isolationDSN, "", config{
+			runID:      "run",
+			companions: comps,
+			connConstructor: func(opt *clickhouse.Options) (driver.Conn, error) {
+				return conn, nil
+			},
+			migrator: func(ctx context.Context, migratorConfig MigratorConfig) error {
+				assert.Equal(t, map[string]string{
+					"kafka_broker":       "groclick-redpanda:9092",
+					"kafka_group":        "groclick_run_1",
+					"kafka_topic_events": "groclick_run_1_events",
+				}, migratorConfig.Variables)
+				return nil
+			},
+		})
+
+		var deps struct {
+			Kafka *Kafka `groat:"clickhouse.kafka"`
+		}
+
+		deps = injectCompanions(t, deps, comps, fork.fork(t, "", nil, nil))
+		require.NotNil(t, deps.Kafka)
+		assert.Equal(t, "groclick_run_1_events", deps.Kafka.Topics["events"])
+	})
+
+	t.Run("should be able to reject hosted mode", func(t *testing.T) {
+		_, err := hostedBootstrapper[struct{}](config{
+			hostedDBNamespace: "ns",
+			redpandaImage:     defaultRedpandaImage,
+		})(t.Context())
+		require.ErrorIs(t, err, ErrCompanionRequiresContainer)
+	})
+}
+
+func TestKafka_Produce(t *testing.T) {
+	newKafka := func(t *testing.T, handler http.HandlerFunc) *Kafka {
+		server := httptest.NewServer(handler)
+		t.Cleanup(server.Close)
+
+		return &Kafka{Topics: map[string]string{"events": "db_events"}, proxy: server.URL, client: server.Client()}
+	}
+
+	t.Run("should be able to produce records", func(t *testing.T) {
+		kafka := newKafka(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/topics/db_events", r.URL.Path)
+			assert.Equal(t, kafkaBinaryMediaType, r.Header.Get("Content-Type"))
+
+			var records kafkaRecords
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&records))
+			assert.Equal(t, []kafkaRecord{{Value: base64.StdEncoding.EncodeToString([]byte(`{"id":1}`))}},
+				records.Records)
+
+			_, _ = w.Write([]byte(`{"offsets":[{"partition":0,"offset":0}]}`))
+		})
+
+		require.NoError(t, kafka.Produce(t.Context(), "events", []byte(`{"id":1}`)))
+	})
+
+	t.Run("should be able failed", func(t *testing.T) {
+		t.Run("when topic is unknown", func(t *testing.T) {
+			require.ErrorIs(t, (&Kafka{}).Produce(t.Context(), "events"), ErrUnknownTopic)
+		})
+
+		t.Run("when proxy rejects request", func(t *testing.T) {
+			kafka := newKafka(t, func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "bad request", http.StatusBadRequest)
+			})
+
+			err := kafka.Produce(t.Context(), "events", []byte("x"))
+			require.ErrorIs(t, err, ErrKafkaProduce)
+			assert.Contains(t, err.Error(), "status 400: bad request")
+		})
+
+		t.Run("when record is rejected", func(t *testing.T) {
+			kafka := newKafka(t, func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`{"offsets":[{"partition":-1,"offset":-1,"error_code":3,"message":"unknown"}]}`))
+			})
+
+			err := kafka.Produce(t.Context(), "events", []byte("x"))
+			require.ErrorIs(t, err, ErrKafkaProduce)
+			assert.Contains(t, err.Error(), "error code 3: unknown")
+		})
+	})
+}
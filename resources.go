@@ -0,0 +1,103 @@
+package groclick
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+const (
+	containerMemoryConfigPath = "/etc/clickhouse-server/config.d/groclick-memory.xml"
+	nanoCPUs                  = 1e9
+)
+
+// WithMemoryLimit limits memory of ClickHouse container in bytes, container is OOM-killed above it.
+func WithMemoryLimit(bytes int) Option {
+	return func(c *config) {
+		c.memoryLimit = bytes
+	}
+}
+
+// WithCPULimit limits ClickHouse container to fractional number of CPUs.
+func WithCPULimit(cpus float64) Option {
+	return func(c *config) {
+		c.cpuLimit = cpus
+	}
+}
+
+// WithNoFileLimit sets nofile ulimit of ClickHouse container, server warns when it is lower than 262144.
+func WithNoFileLimit(limit int) Option {
+	return func(c *config) {
+		c.noFileLimit = limit
+	}
+}
+
+func WithShmSize(bytes int) Option {
+	return func(c *config) {
+		c.shmSize = bytes
+	}
+}
+
+// WithMaxServerMemoryUsage sets max_server_memory_usage of ClickHouse server in bytes, queries exceeding it
+// fail with MEMORY_LIMIT_EXCEEDED instead of container being OOM-killed.
+func WithMaxServerMemoryUsage(bytes int) Option {
+	return func(c *config) {
+		c.maxServerMemoryUsage = bytes
+	}
+}
+
+func (c config) limitsResources() bool {
+	return c.memoryLimit > 0 || c.cpuLimit > 0 || c.noFileLimit > 0 || c.shmSize > 0 || c.maxServerMemoryUsage > 0
+}
+
+func (c config) resourcesCustomizer() testcontainers.CustomizeRequestOption {
+	return func(req *testcontainers.GenericContainerRequest) error {
+		if c.maxServerMemoryUsage > 0 {
+			req.Files = append(req.Files, testcontainers.ContainerFile{
+				Reader:            strings.NewReader(containerMemoryConfig(c.maxServerMemoryUsage)),
+				ContainerFilePath: containerMemoryConfigPath,
+				FileMode:          certFileMode,
+			})
+		}
+
+		modifier := req.HostConfigModifier
+
+		req.HostConfigModifier = func(hostConfig *container.HostConfig) {
+			if modifier != nil {
+				modifier(hostConfig)
+			}
+
+			if c.memoryLimit > 0 {
+				hostConfig.Memory = int64(c.memoryLimit)
+			}
+
+			if c.cpuLimit > 0 {
+				hostConfig.NanoCPUs = int64(c.cpuLimit * nanoCPUs)
+			}
+
+			if c.shmSize > 0 {
+				hostConfig.ShmSize = int64(c.shmSize)
+			}
+
+			if c.noFileLimit > 0 {
+				hostConfig.Ulimits = append(hostConfig.Ulimits, &units.Ulimit{
+					Name: "nofile",
+					Soft: int64(c.noFileLimit),
+					Hard: int64(c.noFileLimit),
+				})
+			}
+		}
+
+		return nil
+	}
+}
+
+func containerMemoryConfig(bytes int) string {
+	return `<clickhouse>
+    <max_server_memory_usage>` + strconv.Itoa(bytes) + `</max_server_memory_usage>
+</clickhouse>
+`
+}
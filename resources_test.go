@@ -0,0 +1,64 @@
+package groclick
+
+import (
+	"io"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestResources(t *testing.T) {
+	t.Run("should be able to limit container resources", func(t *testing.T) {
+		cfg := config{}
+		for _, opt := range []Option{
+			WithMemoryLimit(2 << 30),
+			WithCPULimit(1.5),
+			WithNoFileLimit(262144),
+			WithShmSize(256 << 20),
+			WithMaxServerMemoryUsage(1 << 30),
+		} {
+			opt(&cfg)
+		}
+		require.True(t, cfg.limitsResources())
+
+		req := testcontainers.GenericContainerRequest{}
+		require.NoError(t, hostGateway("host")(&req))
+		require.NoError(t, cfg.resourcesCustomizer()(&req))
+
+		hostConfig := &container.HostConfig{}
+		req.HostConfigModifier(hostConfig)
+
+		assert.Equal(t, int64(2<<30), hostConfig.Memory)
+		assert.Equal(t, int64(1500000000), hostConfig.NanoCPUs)
+		assert.Equal(t, int64(256<<20), hostConfig.ShmSize)
+		assert.Equal(t, []*units.Ulimit{{Name: "nofile", Soft: 262144, Hard: 262144}}, hostConfig.Ulimits)
+		assert.Equal(t, []string{"host:host-gateway"}, hostConfig.ExtraHosts)
+
+		require.Len(t, req.Files, 1)
+		assert.Equal(t, containerMemoryConfigPath, req.Files[0].ContainerFilePath)
+
+		data, err := io.ReadAll(req.Files[0].Reader)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "<max_server_memory_usage>1073741824</max_server_memory_usage>")
+	})
+
+	t.Run("should be able to keep defaults without limits", func(t *testing.T) {
+		assert.False(t, config{}.limitsResources())
+	})
+
+	t.Run("should be able to resolve limits from env", func(t *testing.T) {
+		cfg := defaultConfig()
+
+		_, err := resolveConfig(&cfg, envFrom(map[string]string{
+			"GROAT_I9N_CH_CPU_LIMIT":    "0.5",
+			"GROAT_I9N_CH_MEMORY_LIMIT": "1048576",
+		}))
+		require.NoError(t, err)
+		assert.InDelta(t, 0.5, cfg.cpuLimit, 0)
+		assert.Equal(t, 1048576, cfg.memoryLimit)
+	})
+}
@@ -0,0 +1,123 @@
+package groclick
+
+import (
+	"strings"
+
+	"github.com/godepo/groclick/internal/pkg/sqltoken"
+)
+
+// WithDatabaseRewrite maps database names hardcoded in migrations to database created for test.
+func WithDatabaseRewrite(sources ...string) Option {
+	return func(c *config) {
+		c.databaseRewrite = sources
+	}
+}
+
+// RewriteDatabases replaces database names from mapping keys with values in qualified identifiers, dictionary
+// sources, dictGet arguments and remote, cluster and Distributed database arguments.
+func RewriteDatabases(statement string, mapping map[string]string) string {
+	if len(mapping) == 0 {
+		return statement
+	}
+
+	tokens := sqltoken.Tokenize(statement)
+	words := sqltoken.Significant(tokens)
+	word := func(i int) *sqltoken.Token {
+		if i < 0 || i >= len(words) {
+			return &sqltoken.Token{}
+		}
+
+		return &tokens[words[i]]
+	}
+
+	for i := range words {
+		token := word(i)
+
+		switch {
+		case token.IsIdentifier() && word(i+1).Text == "." && word(i+2).IsIdentifier() && word(i-1).Text != ".":
+			rewriteDatabaseToken(token, mapping)
+		case token.Kind == sqltoken.String && word(i-1).Is("DB"):
+			rewriteDatabaseToken(token, mapping)
+		case token.Kind == sqltoken.Word && word(i+1).Text == "(":
+			rewriteFunctionArgs(token, i+2, word, mapping)
+		}
+	}
+
+	return sqltoken.Join(tokens)
+}
+
+func rewriteFunctionArgs(
+	function *sqltoken.Token,
+	from int,
+	word func(i int) *sqltoken.Token,
+	mapping map[string]string,
+) {
+	name := strings.ToLower(function.Text)
+
+	switch {
+	case strings.HasPrefix(name, "dictget") || name == "dicthas":
+		arg := word(from)
+		if arg.Kind != sqltoken.String || word(from+1).Text != "," {
+			return
+		}
+
+		db, dict, ok := strings.Cut(arg.Value(), ".")
+		if target, found := mapping[db]; ok && found {
+			arg.Text = quoteString(target + "." + dict)
+		}
+	case name == "remote" || name == "remotesecure" || name == "cluster" ||
+		name == "clusterallreplicas" || name == "distributed":
+		depth := 0
+		arg := 0
+
+		for i := from; word(i).Text != ""; i++ {
+			switch word(i).Text {
+			case "(":
+				depth++
+			case ")":
+				if depth == 0 {
+					return
+				}
+				depth--
+			case ",":
+				if depth == 0 {
+					arg++
+				}
+			}
+
+			if arg == 1 && depth == 0 && word(i-1).Text == "," && (word(i+1).Text == "," || word(i+1).Text == ")") {
+				rewriteDatabaseToken(word(i), mapping)
+
+				return
+			}
+		}
+	}
+}
+
+func rewriteDatabaseToken(token *sqltoken.Token, mapping map[string]string) {
+	target, ok := mapping[token.Value()]
+	if !ok {
+		return
+	}
+
+	switch token.Kind {
+	case sqltoken.String:
+		token.Text = quoteString(target)
+	case sqltoken.Word, sqltoken.QuotedIdentifier:
+		token.Text = quoteIdentifier(target)
+	default:
+	}
+}
+
+func databaseMapping(sources []string, target string) map[string]string {
+	if len(sources) == 0 {
+		return nil
+	}
+
+	res := make(map[string]string, len(sources))
+	for _, source := range sources {
+		res[source] = target
+	}
+
+	return res
+}
@@ -0,0 +1,63 @@
+package groclick
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRewriteDatabases(t *testing.T) {
+	mapping := map[string]string{"analytics": "groclick_run_1"}
+
+	cases := map[string]string{
+		"CREATE TABLE analytics.events (id UInt64) ENGINE = Memory": "" +
+			"CREATE TABLE `groclick_run_1`.events (id UInt64) ENGINE = Memory",
+		"CREATE MATERIALIZED VIEW `analytics`.mv TO analytics.events_agg AS SELECT id FROM analytics.events": "" +
+			"CREATE MATERIALIZED VIEW `groclick_run_1`.mv TO `groclick_run_1`.events_agg " +
+			"AS SELECT id FROM `groclick_run_1`.events",
+		"CREATE DICTIONARY d (id UInt64) PRIMARY KEY id SOURCE(CLICKHOUSE(DB 'analytics' TABLE 'src'))": "" +
+			"CREATE DICTIONARY d (id UInt64) PRIMARY KEY id SOURCE(CLICKHOUSE(DB 'groclick_run_1' TABLE 'src'))",
+		"CREATE TABLE d AS analytics.events ENGINE = Distributed('main', analytics, events, rand())": "" +
+			"CREATE TABLE d AS `groclick_run_1`.events ENGINE = Distributed('main', `groclick_run_1`, events, rand())",
+		"SELECT * FROM remote('localhost', 'analytics', 'events')": "" +
+			"SELECT * FROM remote('localhost', 'groclick_run_1', 'events')",
+		"SELECT dictGet('analytics.d', 'name', id) FROM t": "" +
+			"SELECT dictGet('groclick_run_1.d', 'name', id) FROM t",
+		"SELECT t.analytics.x, 'analytics.events' FROM other.t": "" +
+			"SELECT t.analytics.x, 'analytics.events' FROM other.t",
+		"SELECT * FROM remote('analytics', other, events)":      "SELECT * FROM remote('analytics', other, events)",
+		"SELECT * FROM cluster('main', concat('analytics'), t)": "SELECT * FROM cluster('main', concat('analytics'), t)",
+	}
+
+	for statement, exp := range cases {
+		assert.Equal(t, exp, RewriteDatabases(statement, mapping), statement)
+	}
+
+	assert.Equal(t, "CREATE TABLE analytics.t", RewriteDatabases("CREATE TABLE analytics.t", nil))
+}
+
+func TestForker_DatabaseRewrite(t *testing.T) {
+	root := NewMockConn(t)
+	conn := NewMockConn(t)
+
+	fork := newForker(t.Context(), root, isolationDSN, "", config{
+		runID:           "run",
+		databaseRewrite: []string{"analytics"},
+		connConstructor: func(opt *clickhouse.Options) (driver.Conn, error) {
+			return conn, nil
+		},
+		migrator: func(ctx context.Context, migratorConfig MigratorConfig) error {
+			assert.Equal(t, map[string]string{"analytics": "groclick_run_1"}, migratorConfig.Databases)
+			return nil
+		},
+	})
+
+	root.EXPECT().Exec(mock.Anything, mock.Anything).Return(nil)
+	conn.EXPECT().Ping(mock.Anything).Return(nil)
+
+	_ = fork.fork(t, "", nil, nil)
+}
@@ -0,0 +1,195 @@
+package groclick
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/godepo/groclick/internal/pkg/sqltoken"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	envUpdateSchema      = envPrefix + "UPDATE_SCHEMA"
+	schemaDatabaseMarker = "{database}"
+	schemaFileMode       = 0o644
+
+	// schemaInnerTablePrefix starts names of implicit tables of materialized views, .inner.<view> and
+	// .inner_id.<uuid>, the latter differs between forks.
+	schemaInnerTablePrefix = ".inner"
+)
+
+var ErrSchemaRequiresSelect = errors.New("schema snapshot requires DB with Select method")
+
+type (
+	schemaReader interface {
+		Select(ctx context.Context, dest any, query string, args ...any) error
+	}
+
+	schemaObject struct {
+		Name  string `ch:"name"`
+		Query string `ch:"query"`
+	}
+)
+
+// SchemaSnapshot renders schema of migrated database: tables and views without inner tables of materialized
+// views, dictionaries and SQL user defined functions of cfg.Functions, sorted by name and with database name
+// and function namespace removed, so snapshots of different forks are equal. Names of sibling databases of
+// cfg.Databases are replaced with their logical names. User defined functions are server-global, so they are
+// rendered only with WithFunctionNamespacing.
+func SchemaSnapshot(ctx context.Context, cfg MigratorConfig) (string, error) {
+	reader, ok := cfg.DB.(schemaReader)
+	if !ok {
+		return "", ErrSchemaRequiresSelect
+	}
+
+	var tables []schemaObject
+
+	err := reader.Select(ctx, &tables,
+		"SELECT name, create_table_query AS query FROM system.tables WHERE database = ? AND NOT is_temporary",
+		cfg.DBName,
+	)
+	if err != nil {
+		return "", fmt.Errorf("can't read tables of database %s: %w", cfg.DBName, err)
+	}
+
+	tables = slices.DeleteFunc(tables, func(table schemaObject) bool {
+		return strings.HasPrefix(table.Name, schemaInnerTablePrefix)
+	})
+
+	logical := make(map[string]string, len(cfg.Functions))
+	names := make([]string, 0, len(cfg.Functions))
+
+	for function, name := range cfg.Functions {
+		logical[name] = function
+		names = append(names, name)
+	}
+
+	var functions []schemaObject
+
+	if len(names) > 0 {
+		slices.Sort(names)
+
+		err = reader.Select(ctx, &functions,
+			"SELECT name, create_query AS query FROM system.functions WHERE origin = 'SQLUserDefined' AND name IN ?",
+			names,
+		)
+		if err != nil {
+			return "", fmt.Errorf("can't read user defined functions: %w", err)
+		}
+	}
+
+	for i := range functions {
+		functions[i].Name = logical[functions[i].Name]
+	}
+
+	siblings := make(map[string]string, len(cfg.Databases))
+	for name, database := range cfg.Databases {
+		if database != cfg.DBName {
+			siblings[database] = name
+		}
+	}
+
+	var builder strings.Builder
+
+	for _, objects := range [][]schemaObject{tables, functions} {
+		slices.SortFunc(objects, func(a, b schemaObject) int {
+			return strings.Compare(a.Name, b.Name)
+		})
+
+		for _, object := range objects {
+			builder.WriteString(normalizeSchemaQuery(RewriteFunctions(object.Query, logical), cfg.DBName, siblings))
+			builder.WriteString(";\n\n")
+		}
+	}
+
+	return builder.String(), nil
+}
+
+// AssertSchema compares schema snapshot with golden file, golden file is rewritten
+// when GROAT_I9N_CH_UPDATE_SCHEMA is set.
+func AssertSchema(t *testing.T, cfg MigratorConfig, golden string) {
+	t.Helper()
+
+	assertSchema(t, afero.NewOsFs(), cfg, golden, os.Getenv(envUpdateSchema) != "")
+}
+
+func assertSchema(t *testing.T, fs afero.Fs, cfg MigratorConfig, golden string, update bool) {
+	t.Helper()
+
+	snapshot, err := SchemaSnapshot(t.Context(), cfg)
+	require.NoError(t, err)
+
+	if update {
+		require.NoError(t, afero.WriteFile(fs, golden, []byte(snapshot), schemaFileMode))
+
+		return
+	}
+
+	exp, err := readFile(fs, golden)
+	require.NoError(t, err, "set %s=1 to create golden schema file", envUpdateSchema)
+
+	assert.Equal(t, string(exp), snapshot,
+		"schema drift detected, set %s=1 to update %s", envUpdateSchema, golden,
+	)
+}
+
+// normalizeSchemaQuery removes qualifier of migrated database and replaces names of sibling databases, which
+// are keys of siblings, with their logical names.
+func normalizeSchemaQuery(query, database string, siblings map[string]string) string {
+	strs := schemaStringReplacer(database, siblings)
+	tokens := sqltoken.Tokenize(strings.TrimSpace(query))
+	res := make([]sqltoken.Token, 0, len(tokens))
+
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+
+		if token.IsIdentifier() && token.Value() == database &&
+			i+1 < len(tokens) && tokens[i+1].Kind == sqltoken.Punct && tokens[i+1].Text == "." {
+			i++
+
+			continue
+		}
+
+		if logical, ok := siblings[token.Value()]; ok && token.IsIdentifier() {
+			token.Text = strings.Replace(token.Text, token.Value(), logical, 1)
+		}
+
+		if token.Kind == sqltoken.String {
+			token.Text = strs.Replace(token.Text)
+		}
+
+		res = append(res, token)
+	}
+
+	return sqltoken.Join(res)
+}
+
+// schemaStringReplacer replaces longer names first, so name which is prefix of another one doesn't break it.
+func schemaStringReplacer(database string, siblings map[string]string) *strings.Replacer {
+	names := append(slices.Collect(maps.Keys(siblings)), database)
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Or(len(b)-len(a), strings.Compare(a, b))
+	})
+
+	pairs := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		if name == database {
+			pairs = append(pairs, name, schemaDatabaseMarker)
+
+			continue
+		}
+
+		pairs = append(pairs, name, siblings[name])
+	}
+
+	return strings.NewReplacer(pairs...)
+}
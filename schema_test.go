@@ -0,0 +1,168 @@
+package groclick
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	schemaTablesQuery = "SELECT name, create_table_query AS query FROM system.tables " +
+		"WHERE database = ? AND NOT is_temporary"
+	schemaFunctionsQuery = "SELECT name, create_query AS query FROM system.functions " +
+		"WHERE origin = 'SQLUserDefined' AND name IN ?"
+	expectedSchema = "CREATE TABLE events (id UInt64) ENGINE = ReplicatedMergeTree('/ch/{database}/events', " +
+		"'{replica}') ORDER BY id;\n\n" +
+		"CREATE MATERIALIZED VIEW events_mv TO `events_agg` AS SELECT `plus_one`(id) FROM events;\n\n" +
+		"CREATE FUNCTION `plus_one` AS x -> (x + 1);\n\n"
+)
+
+func schemaConfig(conn *MockConn, db string) MigratorConfig {
+	return MigratorConfig{DB: conn, DBName: db, Functions: functionMapping([]string{"plus_one"}, db)}
+}
+
+func arrangeSchema(conn *MockConn, db string) {
+	conn.EXPECT().
+		Select(mock.Anything, mock.Anything, schemaTablesQuery, []any{db}).
+		RunAndReturn(func(ctx context.Context, dest any, query string, args ...any) error {
+			*dest.(*[]schemaObject) = []schemaObject{
+				{Name: "events_mv", Query: "CREATE MATERIALIZED VIEW " + db + ".events_mv TO `" + db +
+					"`.`events_agg` AS SELECT " + db + "_plus_one(id) FROM " + db + ".events"},
+				{Name: "events", Query: "CREATE TABLE " + db + ".events (id UInt64) ENGINE = " +
+					"ReplicatedMergeTree('/ch/" + db + "/events', '{replica}') ORDER BY id"},
+				{Name: ".inner_id." + uuid.NewString(), Query: "CREATE TABLE " + db + ".`.inner_id` (id UInt64)"},
+			}
+			return nil
+		})
+	conn.EXPECT().
+		Select(mock.Anything, mock.Anything, schemaFunctionsQuery, []any{[]string{db + "_plus_one"}}).
+		RunAndReturn(func(ctx context.Context, dest any, query string, args ...any) error {
+			*dest.(*[]schemaObject) = []schemaObject{
+				{Name: db + "_plus_one", Query: "CREATE FUNCTION " + db + "_plus_one AS x -> (x + 1)"},
+			}
+			return nil
+		})
+}
+
+func TestSchemaSnapshot(t *testing.T) {
+	t.Run("should be able to render normalized schema", func(t *testing.T) {
+		conn := NewMockConn(t)
+		arrangeSchema(conn, "groclick_run_1")
+
+		res, err := SchemaSnapshot(t.Context(), schemaConfig(conn, "groclick_run_1"))
+		require.NoError(t, err)
+		assert.Equal(t, expectedSchema, res)
+	})
+
+	t.Run("should be able to render equal schema of different forks", func(t *testing.T) {
+		first, second := NewMockConn(t), NewMockConn(t)
+		arrangeSchema(first, "groclick_run_1")
+		arrangeSchema(second, "groclick_run_2")
+
+		res, err := SchemaSnapshot(t.Context(), schemaConfig(first, "groclick_run_1"))
+		require.NoError(t, err)
+
+		other, err := SchemaSnapshot(t.Context(), schemaConfig(second, "groclick_run_2"))
+		require.NoError(t, err)
+		assert.Equal(t, res, other)
+	})
+
+	t.Run("should be able to replace sibling databases with logical names", func(t *testing.T) {
+		snapshot := func(raw, agg string) string {
+			conn := NewMockConn(t)
+			conn.EXPECT().
+				Select(mock.Anything, mock.Anything, schemaTablesQuery, []any{raw}).
+				RunAndReturn(func(ctx context.Context, dest any, query string, args ...any) error {
+					*dest.(*[]schemaObject) = []schemaObject{
+						{Name: "totals", Query: "CREATE VIEW " + raw + ".totals AS SELECT * FROM `" + agg + "`.totals"},
+						{Name: "totals_dict", Query: "CREATE DICTIONARY " + raw + ".totals_dict (id UInt64) " +
+							"PRIMARY KEY id SOURCE(CLICKHOUSE(DB '" + agg + "' TABLE 'totals')) LAYOUT(FLAT())"},
+					}
+					return nil
+				})
+
+			res, err := SchemaSnapshot(t.Context(), MigratorConfig{
+				DB:        conn,
+				DBName:    raw,
+				Databases: map[string]string{"raw": raw, "agg": agg},
+			})
+			require.NoError(t, err)
+
+			return res
+		}
+
+		res := snapshot("groclick_raw_run_1", "groclick_agg_run_2")
+		assert.Equal(t, "CREATE VIEW totals AS SELECT * FROM `agg`.totals;\n\n"+
+			"CREATE DICTIONARY totals_dict (id UInt64) PRIMARY KEY id "+
+			"SOURCE(CLICKHOUSE(DB 'agg' TABLE 'totals')) LAYOUT(FLAT());\n\n", res)
+		assert.Equal(t, res, snapshot("groclick_raw_run_3", "groclick_agg_run_4"))
+	})
+
+	t.Run("should be able to skip functions without namespacing", func(t *testing.T) {
+		conn := NewMockConn(t)
+		conn.EXPECT().Select(mock.Anything, mock.Anything, schemaTablesQuery, []any{"db"}).Return(nil)
+
+		res, err := SchemaSnapshot(t.Context(), MigratorConfig{DB: conn, DBName: "db"})
+		require.NoError(t, err)
+		assert.Empty(t, res)
+	})
+
+	t.Run("should be able failed", func(t *testing.T) {
+		t.Run("when DB can't select", func(t *testing.T) {
+			_, err := SchemaSnapshot(t.Context(), MigratorConfig{DB: NewMockDB(t)})
+			require.ErrorIs(t, err, ErrSchemaRequiresSelect)
+		})
+
+		t.Run("when can't read tables", func(t *testing.T) {
+			conn := NewMockConn(t)
+			exp := errors.New(uuid.NewString())
+
+			conn.EXPECT().Select(mock.Anything, mock.Anything, schemaTablesQuery, []any{"db"}).Return(exp)
+
+			_, err := SchemaSnapshot(t.Context(), MigratorConfig{DB: conn, DBName: "db"})
+			require.ErrorIs(t, err, exp)
+		})
+
+		t.Run("when can't read functions", func(t *testing.T) {
+			conn := NewMockConn(t)
+			exp := errors.New(uuid.NewString())
+
+			conn.EXPECT().Select(mock.Anything, mock.Anything, schemaTablesQuery, []any{"db"}).Return(nil)
+			conn.EXPECT().Select(mock.Anything, mock.Anything, schemaFunctionsQuery, []any{[]string{"db_plus_one"}}).
+				Return(exp)
+
+			_, err := SchemaSnapshot(t.Context(), schemaConfig(conn, "db"))
+			require.ErrorIs(t, err, exp)
+		})
+	})
+}
+
+func TestAssertSchema(t *testing.T) {
+	t.Run("should be able to update golden file", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		conn := NewMockConn(t)
+		arrangeSchema(conn, "groclick_run_2")
+
+		assertSchema(t, fs, schemaConfig(conn, "groclick_run_2"), "/schema.sql", true)
+
+		data, err := afero.ReadFile(fs, "/schema.sql")
+		require.NoError(t, err)
+		assert.Equal(t, expectedSchema, string(data))
+	})
+
+	t.Run("should be able to compare with golden file", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		conn := NewMockConn(t)
+		arrangeSchema(conn, "groclick_run_3")
+
+		require.NoError(t, afero.WriteFile(fs, "/schema.sql", []byte(expectedSchema), schemaFileMode))
+
+		assertSchema(t, fs, schemaConfig(conn, "groclick_run_3"), "/schema.sql", false)
+	})
+}
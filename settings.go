@@ -0,0 +1,334 @@
+package groclick
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	envPrefix     = "GROAT_I9N_CH_"
+	envConfigFile = envPrefix + "CONFIG"
+	maskedValue   = "******"
+
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceOption  = "option"
+	SourceEnv     = "env"
+)
+
+var (
+	ErrUnknownConfigKey = errors.New("unknown config key")
+	ErrInvalidIsolation = errors.New("invalid isolation mode")
+)
+
+type (
+	ResolvedSetting struct {
+		Key    string
+		Env    string
+		Value  string
+		Source string
+	}
+
+	ResolvedConfig []ResolvedSetting
+
+	setting struct {
+		key    string
+		secret bool
+		get    func(c *config) string
+		set    func(c *config, value string) error
+	}
+
+	lookupEnv func(key string) (string, bool)
+)
+
+var isolationNames = map[Isolation]string{
+	IsolationDatabasePerTest: "database_per_test",
+	IsolationPooledTruncate:  "pooled_truncate",
+	IsolationShared:          "shared",
+}
+
+var configSettings = []setting{
+	stringSetting("image", false, func(c *config) *string { return &c.containerImage }),
+	stringSetting("dsn", true, func(c *config) *string { return &c.hostedDSN }),
+	stringSetting("username", false, func(c *config) *string { return &c.user }),
+	stringSetting("password", true, func(c *config) *string { return &c.password }),
+	stringSetting("namespace", false, func(c *config) *string { return &c.hostedDBNamespace }),
+	stringSetting("migrations_path", false, func(c *config) *string { return &c.migrationsPath }),
+	stringSetting("inject_label", false, func(c *config) *string { return &c.injectLabel }),
+	stringSetting("inject_label_config", false, func(c *config) *string { return &c.injectLabelForConfig }),
+	stringSetting("inject_label_dsn", false, func(c *config) *string { return &c.injectLabelForDSN }),
+	stringSetting("inject_label_s3", false, func(c *config) *string { return &c.injectLabelForS3 }),
+	stringSetting("inject_label_kafka", false, func(c *config) *string { return &c.injectLabelForKafka }),
+	stringSetting("inject_label_dictionaries", false, func(c *config) *string { return &c.injectLabelForDicts }),
+	stringSetting("inject_label_functions", false, func(c *config) *string { return &c.injectLabelForFuncs }),
+	stringSetting("inject_label_databases", false, func(c *config) *string { return &c.injectLabelForDBs }),
+	{
+		key: "isolation",
+		get: func(c *config) string { return c.isolation.String() },
+		set: func(c *config, value string) (err error) {
+			c.isolation, err = ParseIsolation(value)
+			return err
+		},
+	},
+	intSetting("pool_size", func(c *config) *int { return &c.poolSize }),
+	intSetting("max_concurrent_forks", func(c *config) *int { return &c.maxConcurrentForks }),
+	durationSetting("sweep_ttl", func(c *config) *time.Duration { return &c.sweepTTL }),
+	boolSetting("sweep_dry_run", func(c *config) *bool { return &c.sweepDryRun }),
+	stringSetting("cluster", false, func(c *config) *string { return &c.cluster }),
+	durationSetting("cluster_ddl_timeout", func(c *config) *time.Duration { return &c.clusterDDLTimeout }),
+	stringSetting("tls_ca", false, func(c *config) *string { return &c.tlsCAFile }),
+	stringSetting("tls_cert", false, func(c *config) *string { return &c.tlsCertFile }),
+	stringSetting("tls_key", false, func(c *config) *string { return &c.tlsKeyFile }),
+	stringSetting("tls_server_name", false, func(c *config) *string { return &c.tlsServerName }),
+	boolSetting("container_tls", func(c *config) *bool { return &c.containerTLS }),
+	durationSetting("startup_timeout", func(c *config) *time.Duration { return &c.startupTimeout }),
+	durationSetting("readiness_backoff", func(c *config) *time.Duration { return &c.readinessBackoff }),
+	durationSetting("readiness_max_backoff", func(c *config) *time.Duration { return &c.readinessMaxBackoff }),
+	durationSetting("shutdown_timeout", func(c *config) *time.Duration { return &c.shutdownTimeout }),
+	intSetting("terminate_retries", func(c *config) *int { return &c.terminateRetries }),
+	durationSetting("terminate_backoff", func(c *config) *time.Duration { return &c.terminateBackoff }),
+	boolSetting("without_ryuk", func(c *config) *bool { return &c.withoutRyuk }),
+	intSetting("memory_limit", func(c *config) *int { return &c.memoryLimit }),
+	floatSetting("cpu_limit", func(c *config) *float64 { return &c.cpuLimit }),
+	intSetting("nofile_limit", func(c *config) *int { return &c.noFileLimit }),
+	intSetting("shm_size", func(c *config) *int { return &c.shmSize }),
+	intSetting("max_server_memory_usage", func(c *config) *int { return &c.maxServerMemoryUsage }),
+	stringSetting("shutdown_export", false, func(c *config) *string { return &c.shutdownExport }),
+	intSetting("log_tail", func(c *config) *int { return &c.logTail }),
+	stringSetting("minio_image", false, func(c *config) *string { return &c.minioImage }),
+	stringSetting("redpanda_image", false, func(c *config) *string { return &c.redpandaImage }),
+	stringSetting("dictionary_stub_host", false, func(c *config) *string { return &c.dictionaryStubHost }),
+	boolSetting("function_namespacing", func(c *config) *bool { return &c.functionNamespacing }),
+	stringSetting("executable_udfs", false, func(c *config) *string { return &c.executableUDFs }),
+	{
+		key: "timing_report",
+		get: func(c *config) string { return strconv.FormatBool(c.timingReport != nil) },
+		set: func(c *config, value string) error {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return err
+			}
+
+			c.timingReport = nil
+			if enabled {
+				c.timingReport = os.Stderr
+			}
+
+			return nil
+		},
+	},
+	stringSetting("timing_report_file", false, func(c *config) *string { return &c.timingReportFile }),
+	{
+		key: "container_logs",
+		get: func(c *config) string { return c.containerLogs.String() },
+		set: func(c *config, value string) (err error) {
+			c.containerLogs, err = ParseLogLevel(value)
+			return err
+		},
+	},
+}
+
+func WithConfigFile(path string) Option {
+	return func(c *config) {
+		c.configFile = path
+	}
+}
+
+// ResolveConfig returns configuration which New would use with the same options. Values are resolved
+// in order: defaults, config file, options, environment variables; secrets are masked. Only options with
+// scalar values have config keys, options taking functions, slices or maps (migrator, readiness probes,
+// settings, databases, kafka topics, dictionary stand-ins, functions, logger, lint, shutdown handler)
+// are applied as is. Option keeping default value doesn't override config file.
+func ResolveConfig(options ...Option) (ResolvedConfig, error) {
+	cfg := defaultConfig()
+
+	return resolveConfig(&cfg, os.LookupEnv, options...)
+}
+
+func (i Isolation) String() string {
+	if name, ok := isolationNames[i]; ok {
+		return name
+	}
+
+	return strconv.Itoa(int(i))
+}
+
+func ParseIsolation(value string) (Isolation, error) {
+	for isolation, name := range isolationNames {
+		if strings.EqualFold(name, value) {
+			return isolation, nil
+		}
+	}
+
+	return IsolationDatabasePerTest, fmt.Errorf("%w: %s", ErrInvalidIsolation, value)
+}
+
+func (r ResolvedConfig) String() string {
+	lines := make([]string, 0, len(r))
+
+	for _, s := range r {
+		lines = append(lines, fmt.Sprintf("%s=%s (%s)", s.Key, s.Value, s.Source))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func resolveConfig(cfg *config, env lookupEnv, options ...Option) (ResolvedConfig, error) {
+	resolved := make(ResolvedConfig, 0, len(configSettings))
+	for _, s := range configSettings {
+		resolved = append(resolved, ResolvedSetting{Key: s.key, Env: envName(s.key), Source: SourceDefault})
+	}
+
+	defaults := renderSettings(cfg)
+	for _, op := range options {
+		op(cfg)
+	}
+	for i, value := range renderSettings(cfg) {
+		if value != defaults[i] {
+			resolved[i].Source = SourceOption
+		}
+	}
+
+	configFile := cfg.configFile
+	if path, ok := env(envConfigFile); ok && path != "" {
+		configFile = path
+	}
+
+	if configFile != "" {
+		fromFile, err := loadConfigFile(cfg.fs, configFile)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, s := range configSettings {
+			value, ok := fromFile[s.key]
+			if !ok || resolved[i].Source == SourceOption {
+				continue
+			}
+			if err := s.set(cfg, value); err != nil {
+				return nil, fmt.Errorf("invalid %s in config file %s: %w", s.key, configFile, err)
+			}
+			resolved[i].Source = SourceFile
+		}
+	}
+
+	for i, s := range configSettings {
+		value, ok := env(resolved[i].Env)
+		if !ok || value == "" {
+			continue
+		}
+		if err := s.set(cfg, value); err != nil {
+			return nil, fmt.Errorf("invalid %s in %s: %w", s.key, resolved[i].Env, err)
+		}
+		resolved[i].Source = SourceEnv
+	}
+
+	for i, value := range renderSettings(cfg) {
+		if configSettings[i].secret && value != "" {
+			value = maskedValue
+		}
+		resolved[i].Value = value
+	}
+
+	return resolved, nil
+}
+
+func loadConfigFile(fs afero.Fs, path string) (map[string]string, error) {
+	data, err := readFile(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("can't load config file: %w", err)
+	}
+
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("can't parse config file %s: %w", path, err)
+	}
+
+	res := make(map[string]string, len(raw))
+	for key, value := range raw {
+		if !slices.ContainsFunc(configSettings, func(s setting) bool { return s.key == key }) {
+			return nil, fmt.Errorf("%w %s in config file %s", ErrUnknownConfigKey, key, path)
+		}
+		res[key] = fmt.Sprint(value)
+	}
+
+	return res, nil
+}
+
+func renderSettings(cfg *config) []string {
+	res := make([]string, 0, len(configSettings))
+
+	for _, s := range configSettings {
+		res = append(res, s.get(cfg))
+	}
+
+	return res
+}
+
+func envName(key string) string {
+	return envPrefix + strings.ToUpper(key)
+}
+
+func stringSetting(key string, secret bool, field func(c *config) *string) setting {
+	return setting{
+		key:    key,
+		secret: secret,
+		get:    func(c *config) string { return *field(c) },
+		set: func(c *config, value string) error {
+			*field(c) = value
+			return nil
+		},
+	}
+}
+
+func intSetting(key string, field func(c *config) *int) setting {
+	return setting{
+		key: key,
+		get: func(c *config) string { return strconv.Itoa(*field(c)) },
+		set: func(c *config, value string) (err error) {
+			*field(c), err = strconv.Atoi(value)
+			return err
+		},
+	}
+}
+
+func floatSetting(key string, field func(c *config) *float64) setting {
+	return setting{
+		key: key,
+		get: func(c *config) string { return strconv.FormatFloat(*field(c), 'f', -1, 64) },
+		set: func(c *config, value string) (err error) {
+			*field(c), err = strconv.ParseFloat(value, 64)
+			return err
+		},
+	}
+}
+
+func boolSetting(key string, field func(c *config) *bool) setting {
+	return setting{
+		key: key,
+		get: func(c *config) string { return strconv.FormatBool(*field(c)) },
+		set: func(c *config, value string) (err error) {
+			*field(c), err = strconv.ParseBool(value)
+			return err
+		},
+	}
+}
+
+func durationSetting(key string, field func(c *config) *time.Duration) setting {
+	return setting{
+		key: key,
+		get: func(c *config) string { return field(c).String() },
+		set: func(c *config, value string) (err error) {
+			*field(c), err = time.ParseDuration(value)
+			return err
+		},
+	}
+}
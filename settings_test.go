@@ -0,0 +1,181 @@
+package groclick
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func envFrom(values map[string]string) lookupEnv {
+	return func(key string) (string, bool) {
+		value, ok := values[key]
+		return value, ok
+	}
+}
+
+func findSetting(t *testing.T, resolved ResolvedConfig, key string) ResolvedSetting {
+	t.Helper()
+
+	for _, setting := range resolved {
+		if setting.Key == key {
+			return setting
+		}
+	}
+
+	require.Failf(t, "setting not found", "key %s", key)
+
+	return ResolvedSetting{}
+}
+
+func TestResolveConfig(t *testing.T) {
+	t.Run("should be able to apply precedence", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		require.NoError(t, afero.WriteFile(fs, "/groclick.yaml", []byte(`
+username: from-file
+password: secret
+namespace: from-file
+isolation: pooled_truncate
+pool_size: 3
+sweep_ttl: 1h
+`), certFileMode))
+
+		cfg := defaultConfig()
+		cfg.fs = fs
+
+		resolved, err := resolveConfig(&cfg, envFrom(map[string]string{
+			"GROAT_I9N_CH_NAMESPACE":     "from-env",
+			"GROAT_I9N_CH_SWEEP_DRY_RUN": "true",
+		}),
+			WithConfigFile("/groclick.yaml"),
+			WithUsername("from-option"),
+		)
+		require.NoError(t, err)
+
+		assert.Equal(t, "from-option", cfg.user)
+		assert.Equal(t, "secret", cfg.password)
+		assert.Equal(t, "from-env", cfg.hostedDBNamespace)
+		assert.Equal(t, IsolationPooledTruncate, cfg.isolation)
+		assert.Equal(t, 3, cfg.poolSize)
+		assert.Equal(t, time.Hour, cfg.sweepTTL)
+		assert.True(t, cfg.sweepDryRun)
+
+		assert.Equal(t, ResolvedSetting{
+			Key: "username", Env: "GROAT_I9N_CH_USERNAME", Value: "from-option", Source: SourceOption,
+		}, findSetting(t, resolved, "username"))
+		assert.Equal(t, ResolvedSetting{
+			Key: "password", Env: "GROAT_I9N_CH_PASSWORD", Value: maskedValue, Source: SourceFile,
+		}, findSetting(t, resolved, "password"))
+		assert.Equal(t, SourceEnv, findSetting(t, resolved, "namespace").Source)
+		assert.Equal(t, SourceDefault, findSetting(t, resolved, "image").Source)
+		assert.Equal(t, "pooled_truncate", findSetting(t, resolved, "isolation").Value)
+		assert.Contains(t, resolved.String(), "password=****** (file)")
+	})
+
+	t.Run("should be able to read config file path from env", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		require.NoError(t, afero.WriteFile(fs, "/env.yaml", []byte("cluster: main\n"), certFileMode))
+
+		cfg := defaultConfig()
+		cfg.fs = fs
+
+		_, err := resolveConfig(&cfg, envFrom(map[string]string{"GROAT_I9N_CH_CONFIG": "/env.yaml"}),
+			WithConfigFile("/"+uuid.NewString()),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, "main", cfg.cluster)
+	})
+
+	t.Run("should be able to resolve from process env", func(t *testing.T) {
+		t.Setenv("GROAT_I9N_CH_MIGRATIONS_PATH", "/migrations")
+
+		resolved, err := ResolveConfig(WithPassword(uuid.NewString()))
+		require.NoError(t, err)
+		assert.Equal(t, "/migrations", findSetting(t, resolved, "migrations_path").Value)
+		assert.Equal(t, maskedValue, findSetting(t, resolved, "password").Value)
+	})
+
+	t.Run("should be able to apply options once", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		require.NoError(t, afero.WriteFile(fs, "/groclick.yaml", []byte(`
+terminate_backoff: 2s
+readiness_max_backoff: 3s
+inject_label_databases: from-file
+`), certFileMode))
+
+		cfg := defaultConfig()
+		cfg.fs = fs
+		applied := 0
+
+		resolved, err := resolveConfig(&cfg, envFrom(nil),
+			WithConfigFile("/groclick.yaml"),
+			func(c *config) { applied++ },
+			WithReadinessBackoff(time.Second, 5*time.Second),
+		)
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, applied)
+		assert.Equal(t, 2*time.Second, cfg.terminateBackoff)
+		assert.Equal(t, 5*time.Second, cfg.readinessMaxBackoff)
+		assert.Equal(t, "from-file", cfg.injectLabelForDBs)
+		assert.Equal(t, SourceFile, findSetting(t, resolved, "terminate_backoff").Source)
+		assert.Equal(t, SourceOption, findSetting(t, resolved, "readiness_max_backoff").Source)
+	})
+
+	t.Run("should be able failed", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		require.NoError(t, afero.WriteFile(fs, "/unknown.yaml", []byte("unknown: 1\n"), certFileMode))
+		require.NoError(t, afero.WriteFile(fs, "/invalid.yaml", []byte("pool_size: many\n"), certFileMode))
+		require.NoError(t, afero.WriteFile(fs, "/broken.yaml", []byte("- ["), certFileMode))
+
+		cases := map[string]struct {
+			file string
+			env  map[string]string
+		}{
+			"when config file not exists":    {file: "/" + uuid.NewString()},
+			"when config file has bad yaml":  {file: "/broken.yaml"},
+			"when config file has bad value": {file: "/invalid.yaml"},
+			"when env has bad value":         {env: map[string]string{"GROAT_I9N_CH_ISOLATION": "random"}},
+		}
+
+		for name, tc := range cases {
+			t.Run(name, func(t *testing.T) {
+				cfg := defaultConfig()
+				cfg.fs = fs
+
+				_, err := resolveConfig(&cfg, envFrom(tc.env), WithConfigFile(tc.file))
+				require.Error(t, err)
+			})
+		}
+
+		t.Run("when config file has unknown key", func(t *testing.T) {
+			cfg := defaultConfig()
+			cfg.fs = fs
+
+			_, err := resolveConfig(&cfg, envFrom(nil), WithConfigFile("/unknown.yaml"))
+			require.ErrorIs(t, err, ErrUnknownConfigKey)
+		})
+	})
+}
+
+func TestParseIsolation(t *testing.T) {
+	for _, isolation := range []Isolation{IsolationDatabasePerTest, IsolationPooledTruncate, IsolationShared} {
+		res, err := ParseIsolation(isolation.String())
+		require.NoError(t, err)
+		assert.Equal(t, isolation, res)
+	}
+
+	_, err := ParseIsolation(uuid.NewString())
+	require.ErrorIs(t, err, ErrInvalidIsolation)
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	t.Setenv("GROAT_I9N_CH_POOL_SIZE", uuid.NewString())
+
+	res, err := New[Deps]()(t.Context())
+	require.ErrorContains(t, err, "can't resolve config")
+	require.Nil(t, res)
+}
@@ -0,0 +1,281 @@
+package groclick
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/spf13/afero"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+const (
+	defaultShutdownTimeout  = 2 * time.Minute
+	defaultTerminateRetries = 3
+	defaultTerminateBackoff = time.Second
+	exportDirMode           = 0o755
+	exportFormat            = "TSVWithNames"
+	exportLogsFile          = "clickhouse-server.log"
+)
+
+var ErrExportFailed = errors.New("can't export table")
+
+// shutdown runs when bootstrap context is done: exports remaining databases, drops them, flushes server
+// logs and terminates container.
+type shutdown struct {
+	mu        sync.Mutex
+	fork      *forker
+	click     ClickhouseContainer
+	terminate func(ctx context.Context, opts ...testcontainers.TerminateOption) error
+	logs      *containerLogs
+	fs        afero.Fs
+	exportDir string
+	user      string
+	password  string
+	timeout   time.Duration
+	retries   int
+	backoff   time.Duration
+	handler   func(err error)
+	logger    *slog.Logger
+}
+
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.shutdownTimeout = timeout
+	}
+}
+
+// WithTerminateRetries sets number of repeated attempts to terminate container, attempts are separated by backoff.
+func WithTerminateRetries(retries int, backoff time.Duration) Option {
+	return func(c *config) {
+		c.terminateRetries = retries
+		c.terminateBackoff = backoff
+	}
+}
+
+// WithShutdownExport exports tables of databases remaining at shutdown and server logs into dir, for debugging.
+func WithShutdownExport(dir string) Option {
+	return func(c *config) {
+		c.shutdownExport = dir
+	}
+}
+
+// WithShutdownErrorHandler receives aggregated error of shutdown, which is otherwise only logged by container
+// terminator. Handler is called before groat suite returns from Go, so TestMain can fail run when container
+// or databases leaked:
+//
+//	var shutdownErr error
+//	// ... New[Deps](WithShutdownErrorHandler(func(err error) { shutdownErr = err }))
+//	code := suite.Go()
+//	if shutdownErr != nil {
+//		code = 1
+//	}
+//	os.Exit(code)
+func WithShutdownErrorHandler(handler func(err error)) Option {
+	return func(c *config) {
+		c.shutdownHandler = handler
+	}
+}
+
+func newShutdown(
+	cfg config,
+	click ClickhouseContainer,
+	terminate func(ctx context.Context, opts ...testcontainers.TerminateOption) error,
+	logs *containerLogs,
+) *shutdown {
+	return &shutdown{
+		click:     click,
+		terminate: terminate,
+		logs:      logs,
+		fs:        cfg.fs,
+		exportDir: cfg.shutdownExport,
+		user:      cfg.user,
+		password:  cfg.password,
+		timeout:   cfg.shutdownTimeout,
+		retries:   cfg.terminateRetries,
+		backoff:   cfg.terminateBackoff,
+		handler:   cfg.shutdownHandler,
+		logger:    cfg.log(),
+	}
+}
+
+func (s *shutdown) attach(fork *forker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.fork = fork
+}
+
+func (s *shutdown) run(ctx context.Context, opts ...testcontainers.TerminateOption) error {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+
+	s.mu.Lock()
+	fork := s.fork
+	s.mu.Unlock()
+
+	errs := make([]error, 0, 4)
+
+	if fork != nil {
+		if s.exportDir != "" {
+			errs = append(errs, s.export(ctx, fork.root, fork.remaining()))
+		}
+
+		errs = append(errs, fork.dropRemaining(ctx))
+	}
+
+	errs = append(errs, s.flushLogs(ctx), s.terminateWithRetries(ctx, opts...))
+
+	err := errors.Join(errs...)
+	if err != nil && s.handler != nil {
+		s.handler(err)
+	}
+
+	return err
+}
+
+func (s *shutdown) export(ctx context.Context, root driver.Conn, databases []string) error {
+	errs := make([]error, 0)
+
+	for _, database := range databases {
+		var tables []systemTable
+
+		err := root.Select(ctx, &tables, "SELECT name, engine FROM system.tables WHERE database = ?", database)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("can't list tables of database %s: %w", database, err))
+
+			continue
+		}
+
+		for _, table := range tables {
+			if !truncatableEngine(table.Engine) {
+				continue
+			}
+
+			errs = append(errs, s.exportTable(ctx, database, table.Name))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *shutdown) exportTable(ctx context.Context, database, table string) error {
+	query := "SELECT * FROM " + quoteIdentifier(database) + "." + quoteIdentifier(table) + " FORMAT " + exportFormat
+
+	executor, ok := s.click.(containerExecutor)
+	if !ok {
+		return fmt.Errorf("%w %s.%s: %w exec", ErrExportFailed, database, table, ErrUnsupportedContainer)
+	}
+
+	code, out, err := executor.Exec(ctx, []string{
+		"clickhouse-client", "--user", s.user, "--password", s.password, "--query", query,
+	})
+	if err != nil {
+		return fmt.Errorf("%w %s.%s: %w", ErrExportFailed, database, table, err)
+	}
+
+	// stderr is demultiplexed from rows, so warnings of clickhouse-client don't corrupt export
+	var stdout, stderr bytes.Buffer
+
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, out); err != nil {
+		return fmt.Errorf("%w %s.%s: can't read output: %w", ErrExportFailed, database, table, err)
+	}
+
+	if code != 0 {
+		return fmt.Errorf("%w %s.%s: clickhouse-client exited with code %d: %s",
+			ErrExportFailed, database, table, code, strings.TrimSpace(stderr.String()))
+	}
+
+	err = s.write(path.Join(database, table+".tsv"), &stdout)
+	if stderr.Len() > 0 {
+		err = errors.Join(err, fmt.Errorf("%w %s.%s: clickhouse-client stderr: %s",
+			ErrExportFailed, database, table, strings.TrimSpace(stderr.String())))
+	}
+
+	return err
+}
+
+// flushLogs waits for followed logs to be consumed and exports full server log.
+func (s *shutdown) flushLogs(ctx context.Context) error {
+	if s.logs != nil {
+		select {
+		case <-time.After(s.logs.flushDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	if s.exportDir == "" {
+		return nil
+	}
+
+	reader, ok := s.click.(containerLogsReader)
+	if !ok {
+		return fmt.Errorf("can't read container logs: %w logs", ErrUnsupportedContainer)
+	}
+
+	logs, err := reader.Logs(ctx)
+	if err != nil {
+		return fmt.Errorf("can't read container logs: %w", err)
+	}
+
+	defer func() {
+		_ = logs.Close()
+	}()
+
+	return s.write(exportLogsFile, logs)
+}
+
+func (s *shutdown) write(name string, from io.Reader) error {
+	file := path.Join(s.exportDir, name)
+
+	if err := s.fs.MkdirAll(path.Dir(file), exportDirMode); err != nil {
+		return fmt.Errorf("can't create export dir: %w", err)
+	}
+
+	fh, err := s.fs.Create(file)
+	if err != nil {
+		return fmt.Errorf("can't create export file %s: %w", file, err)
+	}
+
+	_, err = io.Copy(fh, from)
+
+	return errors.Join(err, fh.Close())
+}
+
+func (s *shutdown) terminateWithRetries(ctx context.Context, opts ...testcontainers.TerminateOption) error {
+	var err error
+
+	for attempt := 0; attempt <= s.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(s.backoff):
+			case <-ctx.Done():
+				return fmt.Errorf("can't terminate clickhouse container: %w", errors.Join(err, ctx.Err()))
+			}
+		}
+
+		if err = s.terminate(ctx, opts...); err == nil {
+			return nil
+		}
+
+		s.logger.Warn("can't terminate clickhouse container",
+			slog.Int("attempt", attempt+1),
+			slog.Any("error", err),
+		)
+	}
+
+	return fmt.Errorf("can't terminate clickhouse container: %w", err)
+}
@@ -0,0 +1,175 @@
+package groclick
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/google/uuid"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func newShutdownCase(t *testing.T, cfg config) (*shutdown, *MockConn, *MockCapableContainer, *int) {
+	t.Helper()
+
+	root := NewMockConn(t)
+	click := NewMockCapableContainer(t)
+	terminated := 0
+
+	fork := newForker(t.Context(), root, isolationDSN, "", config{runID: "run"})
+	fork.track("db_a", true)
+
+	stop := newShutdown(cfg, click, func(ctx context.Context, opts ...testcontainers.TerminateOption) error {
+		terminated++
+		return nil
+	}, nil)
+	stop.attach(fork)
+
+	return stop, root, click, &terminated
+}
+
+func execOutput(t *testing.T, stdout, stderr string) io.Reader {
+	t.Helper()
+
+	var out bytes.Buffer
+
+	_, err := stdcopy.NewStdWriter(&out, stdcopy.Stdout).Write([]byte(stdout))
+	require.NoError(t, err)
+
+	if stderr != "" {
+		_, err = stdcopy.NewStdWriter(&out, stdcopy.Stderr).Write([]byte(stderr))
+		require.NoError(t, err)
+	}
+
+	return &out
+}
+
+func TestShutdown(t *testing.T) {
+	t.Run("should be able to export and drop remaining databases", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		stop, root, click, terminated := newShutdownCase(t, config{
+			fs:             fs,
+			shutdownExport: "/export",
+			user:           "default",
+			password:       "test",
+		})
+
+		root.EXPECT().
+			Select(mock.Anything, mock.Anything, "SELECT name, engine FROM system.tables WHERE database = ?", []any{"db_a"}).
+			RunAndReturn(func(ctx context.Context, dest any, query string, args ...any) error {
+				*dest.(*[]systemTable) = []systemTable{{Name: "events", Engine: "MergeTree"}, {Name: "view", Engine: "View"}}
+				return nil
+			})
+		click.EXPECT().Exec(mock.Anything, []string{
+			"clickhouse-client", "--user", "default", "--password", "test",
+			"--query", "SELECT * FROM `db_a`.`events` FORMAT TSVWithNames",
+		}).Return(0, execOutput(t, "id\n1\n", ""), nil)
+		root.EXPECT().Exec(mock.Anything, "DROP DATABASE `db_a`").Return(nil).Once()
+		click.EXPECT().Logs(mock.Anything).Return(io.NopCloser(strings.NewReader("server log\n")), nil)
+
+		require.NoError(t, stop.run(t.Context()))
+		assert.Equal(t, 1, *terminated)
+		assert.Empty(t, stop.fork.remaining())
+
+		data, err := afero.ReadFile(fs, "/export/db_a/events.tsv")
+		require.NoError(t, err)
+		assert.Equal(t, "id\n1\n", string(data))
+
+		data, err = afero.ReadFile(fs, "/export/"+exportLogsFile)
+		require.NoError(t, err)
+		assert.Equal(t, "server log\n", string(data))
+	})
+
+	t.Run("should be able to retry termination", func(t *testing.T) {
+		stop, root, _, _ := newShutdownCase(t, config{terminateRetries: 2})
+		root.EXPECT().Exec(mock.Anything, "DROP DATABASE `db_a`").Return(nil).Once()
+
+		attempts := 0
+		stop.terminate = func(ctx context.Context, opts ...testcontainers.TerminateOption) error {
+			attempts++
+			if attempts < 3 {
+				return errors.New(uuid.NewString())
+			}
+			return nil
+		}
+
+		require.NoError(t, stop.run(t.Context()))
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("should be able to report aggregated error", func(t *testing.T) {
+		dropErr := errors.New(uuid.NewString())
+		terminateErr := errors.New(uuid.NewString())
+
+		var reported error
+
+		stop, root, _, _ := newShutdownCase(t, config{
+			terminateRetries: 1,
+			shutdownHandler: func(err error) {
+				reported = err
+			},
+		})
+		stop.terminate = func(ctx context.Context, opts ...testcontainers.TerminateOption) error {
+			return terminateErr
+		}
+		root.EXPECT().Exec(mock.Anything, "DROP DATABASE `db_a`").Return(dropErr).Once()
+
+		err := stop.run(t.Context())
+		require.ErrorIs(t, err, dropErr)
+		require.ErrorIs(t, err, terminateErr)
+		assert.Equal(t, err, reported)
+		assert.Equal(t, []string{"db_a"}, stop.fork.remaining())
+	})
+
+	t.Run("should be able to return error without handler", func(t *testing.T) {
+		dropErr := errors.New(uuid.NewString())
+
+		stop, root, _, terminated := newShutdownCase(t, config{})
+		root.EXPECT().Exec(mock.Anything, "DROP DATABASE `db_a`").Return(dropErr).Once()
+
+		require.ErrorIs(t, stop.run(t.Context()), dropErr)
+		assert.Equal(t, 1, *terminated)
+	})
+
+	t.Run("should be able failed when export failed", func(t *testing.T) {
+		stop, _, click, _ := newShutdownCase(t, config{fs: afero.NewMemMapFs(), shutdownExport: "/export"})
+		click.EXPECT().Exec(mock.Anything, mock.Anything).Return(1, execOutput(t, "", "Code: 60."), nil)
+
+		err := stop.exportTable(t.Context(), "db_a", "events")
+		require.ErrorIs(t, err, ErrExportFailed)
+		assert.Contains(t, err.Error(), "Code: 60.")
+	})
+
+	t.Run("should be able to keep stderr out of export", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		stop, _, click, _ := newShutdownCase(t, config{fs: fs, shutdownExport: "/export"})
+		click.EXPECT().Exec(mock.Anything, mock.Anything).Return(0, execOutput(t, "id\n1\n", "warning\n"), nil)
+
+		err := stop.exportTable(t.Context(), "db_a", "events")
+		require.ErrorIs(t, err, ErrExportFailed)
+		assert.Contains(t, err.Error(), "warning")
+
+		data, err := afero.ReadFile(fs, "/export/db_a/events.tsv")
+		require.NoError(t, err)
+		assert.Equal(t, "id\n1\n", string(data))
+	})
+
+	t.Run("should be able to terminate without forked databases", func(t *testing.T) {
+		terminated := false
+		stop := newShutdown(config{}, nil, func(ctx context.Context, opts ...testcontainers.TerminateOption) error {
+			terminated = true
+			return nil
+		}, nil)
+
+		require.NoError(t, stop.run(t.Context()))
+		assert.True(t, terminated)
+	})
+}
@@ -0,0 +1,242 @@
+package groclick
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+)
+
+const (
+	stampPrefix  = "groclick:"
+	stampRun     = "run"
+	stampHost    = "host"
+	stampCreated = "created"
+)
+
+var (
+	ErrRequireNamespaceForSweep = errors.New("sweep requires namespace prefix")
+	ErrRequirePositiveSweepTTL  = errors.New("sweep requires positive TTL")
+)
+
+type (
+	SweepConfig struct {
+		Namespace string
+		Cluster   string
+		TTL       time.Duration
+		DryRun    bool
+		Now       func() time.Time
+	}
+
+	// SweptDatabase is orphaned database, Functions are namespaced user defined functions created for it.
+	SweptDatabase struct {
+		Name      string
+		RunID     string
+		Host      string
+		Created   time.Time
+		Functions []string
+	}
+
+	systemDatabase struct {
+		Name    string `ch:"name"`
+		Comment string `ch:"comment"`
+	}
+
+	systemFunction struct {
+		Name string `ch:"name"`
+	}
+)
+
+func WithHostedSweep(ttl time.Duration) Option {
+	return func(c *config) {
+		c.sweepTTL = ttl
+	}
+}
+
+func WithHostedSweepDryRun(dryRun bool) Option {
+	return func(c *config) {
+		c.sweepDryRun = dryRun
+	}
+}
+
+func SweepHostedDatabases(ctx context.Context, conn driver.Conn, cfg SweepConfig) ([]SweptDatabase, error) {
+	if cfg.Namespace == "" {
+		return nil, ErrRequireNamespaceForSweep
+	}
+
+	// databases of concurrently running test binaries are younger than TTL only when TTL is positive
+	if cfg.TTL <= 0 {
+		return nil, ErrRequirePositiveSweepTTL
+	}
+
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
+	var databases []systemDatabase
+
+	err := conn.Select(ctx, &databases,
+		"SELECT name, comment FROM system.databases WHERE startsWith(name, ?)",
+		cfg.Namespace,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("can't list hosted databases: %w", err)
+	}
+
+	deadline := cfg.Now().Add(-cfg.TTL)
+	swept := make([]SweptDatabase, 0, len(databases))
+
+	for _, database := range databases {
+		candidate, ok := parseStamp(database.Name, database.Comment)
+		if !ok || !candidate.Created.Before(deadline) || !forkedByRun(candidate.Name, cfg.Namespace, candidate.RunID) {
+			continue
+		}
+
+		candidate.Functions, err = orphanedFunctions(ctx, conn, candidate.Name)
+		if err != nil {
+			return swept, err
+		}
+
+		if !cfg.DryRun {
+			if err := dropOrphaned(ctx, conn, candidate, cfg.Cluster); err != nil {
+				return swept, err
+			}
+		}
+
+		swept = append(swept, candidate)
+	}
+
+	return swept, nil
+}
+
+// orphanedFunctions lists functions namespaced by database, they are prefixed with its name.
+func orphanedFunctions(ctx context.Context, conn driver.Conn, database string) ([]string, error) {
+	var functions []systemFunction
+
+	err := conn.Select(ctx, &functions,
+		"SELECT name FROM system.functions WHERE origin = 'SQLUserDefined' AND startsWith(name, ?)",
+		database+"_",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("can't list functions of orphaned database %s: %w", database, err)
+	}
+
+	res := make([]string, 0, len(functions))
+	for _, function := range functions {
+		res = append(res, function.Name)
+	}
+
+	return res, nil
+}
+
+func dropOrphaned(ctx context.Context, conn driver.Conn, database SweptDatabase, cluster string) error {
+	err := conn.Exec(ctx, "DROP DATABASE IF EXISTS "+quoteIdentifier(database.Name)+onClusterClause(cluster))
+	if err != nil {
+		return fmt.Errorf("can't drop orphaned database %s: %w", database.Name, err)
+	}
+
+	for _, function := range database.Functions {
+		err := conn.Exec(ctx, "DROP FUNCTION IF EXISTS "+quoteIdentifier(function)+onClusterClause(cluster))
+		if err != nil {
+			return fmt.Errorf("can't drop orphaned function %s: %w", function, err)
+		}
+	}
+
+	return nil
+}
+
+func sweepAtBootstrap(ctx context.Context, conn driver.Conn, cfg config) error {
+	if cfg.sweepTTL <= 0 {
+		return nil
+	}
+
+	swept, err := SweepHostedDatabases(ctx, conn, SweepConfig{
+		Namespace: cfg.hostedDBNamespace,
+		Cluster:   cfg.cluster,
+		TTL:       cfg.sweepTTL,
+		DryRun:    cfg.sweepDryRun,
+	})
+
+	for _, db := range swept {
+		cfg.log().Info("orphaned database swept",
+			slog.String("database", db.Name),
+			slog.String("run", db.RunID),
+			slog.String("host", db.Host),
+			slog.Time("created", db.Created),
+			slog.Any("functions", db.Functions),
+			slog.Bool("dry_run", cfg.sweepDryRun),
+		)
+	}
+
+	return err
+}
+
+func databaseStamp(runID string, created time.Time) string {
+	return fmt.Sprintf(
+		"%s%s=%s;%s=%s;%s=%s",
+		stampPrefix,
+		stampRun, runID,
+		stampHost, hostname(),
+		stampCreated, created.UTC().Format(time.RFC3339),
+	)
+}
+
+func parseStamp(name, comment string) (SweptDatabase, bool) {
+	stamp, ok := strings.CutPrefix(comment, stampPrefix)
+	if !ok {
+		return SweptDatabase{}, false
+	}
+
+	res := SweptDatabase{Name: name}
+
+	for _, pair := range strings.Split(stamp, ";") {
+		key, value, _ := strings.Cut(pair, "=")
+		switch key {
+		case stampRun:
+			res.RunID = value
+		case stampHost:
+			res.Host = value
+		case stampCreated:
+			created, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return SweptDatabase{}, false
+			}
+			res.Created = created
+		}
+	}
+
+	return res, !res.Created.IsZero()
+}
+
+// forkedByRun reports whether name has shape of database forked by run, <namespace><base>_[<label>_]<run>_<n>,
+// so stamped databases created by hand are never dropped.
+func forkedByRun(name, namespace, runID string) bool {
+	rest, ok := strings.CutPrefix(name, namespace)
+	if !ok || runID == "" {
+		return false
+	}
+
+	rest, fork, ok := cutLast(rest, "_")
+	if !ok || fork == "" || strings.Trim(fork, "0123456789") != "" {
+		return false
+	}
+
+	return strings.HasSuffix(rest, "_"+runID)
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+
+	return s[:i], s[i+len(sep):], true
+}
+
+func quoteString(value string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(value, `\`, `\\`), "'", `\'`) + "'"
+}
@@ -0,0 +1,223 @@
+package groclick
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/google/uuid"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func arrangeHostedDatabases(conn *MockConn, namespace string, now time.Time, err error) {
+	conn.EXPECT().
+		Select(
+			mock.Anything, mock.Anything,
+			"SELECT name, comment FROM system.databases WHERE startsWith(name, ?)",
+			[]any{namespace},
+		).
+		RunAndReturn(func(ctx context.Context, dest any, query string, args ...any) error {
+			*dest.(*[]systemDatabase) = []systemDatabase{
+				{Name: namespace + "_orphan_old_1", Comment: databaseStamp("old", now.Add(-2*time.Hour))},
+				{Name: namespace + "_fresh_new_2", Comment: databaseStamp("new", now)},
+				{Name: namespace + "_foreign", Comment: "created by hand"},
+				{Name: namespace + "_reports", Comment: databaseStamp("old", now.Add(-2*time.Hour))},
+			}
+			return err
+		})
+}
+
+func arrangeOrphanedFunctions(conn *MockConn, database string, err error) {
+	conn.EXPECT().
+		Select(
+			mock.Anything, mock.Anything,
+			"SELECT name FROM system.functions WHERE origin = 'SQLUserDefined' AND startsWith(name, ?)",
+			[]any{database + "_"},
+		).
+		RunAndReturn(func(ctx context.Context, dest any, query string, args ...any) error {
+			*dest.(*[]systemFunction) = []systemFunction{{Name: database + "_plus_one"}}
+			return err
+		})
+}
+
+func TestSweepHostedDatabases(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	t.Run("should be able to drop orphaned databases", func(t *testing.T) {
+		conn := NewMockConn(t)
+		namespace := "ns"
+
+		arrangeHostedDatabases(conn, namespace, now, nil)
+		arrangeOrphanedFunctions(conn, "ns_orphan_old_1", nil)
+		conn.EXPECT().Exec(mock.Anything, "DROP DATABASE IF EXISTS `ns_orphan_old_1`").Return(nil)
+		conn.EXPECT().Exec(mock.Anything, "DROP FUNCTION IF EXISTS `ns_orphan_old_1_plus_one`").Return(nil)
+
+		swept, err := SweepHostedDatabases(t.Context(), conn, SweepConfig{
+			Namespace: namespace,
+			TTL:       time.Hour,
+			Now:       clock,
+		})
+		require.NoError(t, err)
+		require.Len(t, swept, 1)
+		assert.Equal(t, "ns_orphan_old_1", swept[0].Name)
+		assert.Equal(t, "old", swept[0].RunID)
+		assert.NotEmpty(t, swept[0].Host)
+		assert.Equal(t, []string{"ns_orphan_old_1_plus_one"}, swept[0].Functions)
+	})
+
+	t.Run("should be able to list candidates in dry run", func(t *testing.T) {
+		conn := NewMockConn(t)
+
+		arrangeHostedDatabases(conn, "ns", now, nil)
+		arrangeOrphanedFunctions(conn, "ns_orphan_old_1", nil)
+
+		swept, err := SweepHostedDatabases(t.Context(), conn, SweepConfig{
+			Namespace: "ns",
+			TTL:       time.Hour,
+			DryRun:    true,
+			Now:       clock,
+		})
+		require.NoError(t, err)
+		require.Len(t, swept, 1)
+		assert.Equal(t, []string{"ns_orphan_old_1_plus_one"}, swept[0].Functions)
+	})
+
+	t.Run("should be able failed", func(t *testing.T) {
+		t.Run("when namespace is empty", func(t *testing.T) {
+			_, err := SweepHostedDatabases(t.Context(), NewMockConn(t), SweepConfig{})
+			require.ErrorIs(t, err, ErrRequireNamespaceForSweep)
+		})
+
+		t.Run("when TTL is not positive", func(t *testing.T) {
+			_, err := SweepHostedDatabases(t.Context(), NewMockConn(t), SweepConfig{Namespace: "ns"})
+			require.ErrorIs(t, err, ErrRequirePositiveSweepTTL)
+		})
+
+		t.Run("when can't list databases", func(t *testing.T) {
+			conn := NewMockConn(t)
+			exp := errors.New(uuid.NewString())
+
+			arrangeHostedDatabases(conn, "ns", now, exp)
+
+			_, err := SweepHostedDatabases(t.Context(), conn, SweepConfig{Namespace: "ns", TTL: time.Hour})
+			require.ErrorIs(t, err, exp)
+		})
+
+		t.Run("when can't drop database", func(t *testing.T) {
+			conn := NewMockConn(t)
+			exp := errors.New(uuid.NewString())
+
+			arrangeHostedDatabases(conn, "ns", now, nil)
+			arrangeOrphanedFunctions(conn, "ns_orphan_old_1", nil)
+			conn.EXPECT().Exec(mock.Anything, "DROP DATABASE IF EXISTS `ns_orphan_old_1`").Return(exp)
+
+			_, err := SweepHostedDatabases(t.Context(), conn, SweepConfig{
+				Namespace: "ns",
+				TTL:       time.Hour,
+				Now:       clock,
+			})
+			require.ErrorIs(t, err, exp)
+		})
+
+		t.Run("when can't list functions", func(t *testing.T) {
+			conn := NewMockConn(t)
+			exp := errors.New(uuid.NewString())
+
+			arrangeHostedDatabases(conn, "ns", now, nil)
+			arrangeOrphanedFunctions(conn, "ns_orphan_old_1", exp)
+
+			_, err := SweepHostedDatabases(t.Context(), conn, SweepConfig{
+				Namespace: "ns",
+				TTL:       time.Hour,
+				Now:       clock,
+			})
+			require.ErrorIs(t, err, exp)
+		})
+
+		t.Run("when can't drop function", func(t *testing.T) {
+			conn := NewMockConn(t)
+			exp := errors.New(uuid.NewString())
+
+			arrangeHostedDatabases(conn, "ns", now, nil)
+			arrangeOrphanedFunctions(conn, "ns_orphan_old_1", nil)
+			conn.EXPECT().Exec(mock.Anything, "DROP DATABASE IF EXISTS `ns_orphan_old_1`").Return(nil)
+			conn.EXPECT().Exec(mock.Anything, "DROP FUNCTION IF EXISTS `ns_orphan_old_1_plus_one`").Return(exp)
+
+			_, err := SweepHostedDatabases(t.Context(), conn, SweepConfig{
+				Namespace: "ns",
+				TTL:       time.Hour,
+				Now:       clock,
+			})
+			require.ErrorIs(t, err, exp)
+		})
+	})
+}
+
+func TestSweepAtBootstrap(t *testing.T) {
+	t.Run("should be able to sweep in dry run at bootstrap", func(t *testing.T) {
+		conn := NewMockConn(t)
+		namespace := uuid.NewString()
+
+		arrangeHostedDatabases(conn, namespace, time.Now(), nil)
+		arrangeOrphanedFunctions(conn, namespace+"_orphan_old_1", nil)
+
+		res, err := hostedBootstrapper[Deps](config{
+			hostedDSN:         "http://localhost:8123/?dial_timeout=200ms",
+			hostedDBNamespace: namespace,
+			sweepTTL:          time.Hour,
+			sweepDryRun:       true,
+			fs:                afero.OsFs{},
+			migrationsPath:    "./sql",
+			connConstructor: func(opt *clickhouse.Options) (driver.Conn, error) {
+				return conn, nil
+			},
+		})(t.Context())
+		require.NoError(t, err)
+		require.NotNil(t, res)
+	})
+
+	t.Run("should be able to fail bootstrap when sweep failed", func(t *testing.T) {
+		conn := NewMockConn(t)
+		namespace := uuid.NewString()
+		exp := errors.New(uuid.NewString())
+
+		arrangeHostedDatabases(conn, namespace, time.Now(), exp)
+
+		res, err := hostedBootstrapper[Deps](config{
+			hostedDSN:         "http://localhost:8123/?dial_timeout=200ms",
+			hostedDBNamespace: namespace,
+			sweepTTL:          time.Hour,
+			fs:                afero.OsFs{},
+			migrationsPath:    "./sql",
+			connConstructor: func(opt *clickhouse.Options) (driver.Conn, error) {
+				return conn, nil
+			},
+		})(t.Context())
+		require.ErrorIs(t, err, exp)
+		require.Nil(t, res)
+	})
+}
+
+func TestParseStamp(t *testing.T) {
+	_, ok := parseStamp("db", "groclick:run=1;created=yesterday")
+	assert.False(t, ok)
+
+	assert.Equal(t, `'it\'s'`, quoteString("it's"))
+}
+
+func TestForkedByRun(t *testing.T) {
+	assert.True(t, forkedByRun("ns_groclick_run_1", "ns_", "run"))
+	assert.True(t, forkedByRun("ns_groclick_test_name_run_12", "ns_", "run"))
+	assert.False(t, forkedByRun("ns_groclick_reports", "ns_", "run"))
+	assert.False(t, forkedByRun("ns_groclick_run_x", "ns_", "run"))
+	assert.False(t, forkedByRun("ns_groclick_other_1", "ns_", "run"))
+	assert.False(t, forkedByRun("groclick_run_1", "ns_", "run"))
+	assert.False(t, forkedByRun("ns_groclick_run_1", "ns_", ""))
+}
@@ -0,0 +1,198 @@
+package groclick
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/godepo/groat/pkg/ctxgroup"
+	"github.com/spf13/afero"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+const (
+	PhaseContainerPull  = "container.pull"
+	PhaseContainerStart = "container.start"
+	PhaseConnect        = "connect"
+	PhaseDatabaseCreate = "database.create"
+	PhaseMigrate        = "database.migrate"
+	PhaseTruncate       = "database.truncate"
+	PhaseDrop           = "database.drop"
+
+	timingReportFileMode = 0o644
+)
+
+type (
+	// PhaseTiming aggregates durations of one bootstrap phase, durations are encoded to JSON as nanoseconds.
+	PhaseTiming struct {
+		Phase string        `json:"phase"`
+		Count int           `json:"count"`
+		Total time.Duration `json:"total"`
+		Min   time.Duration `json:"min"`
+		Max   time.Duration `json:"max"`
+	}
+
+	TimingReport struct {
+		Phases []PhaseTiming `json:"phases"`
+	}
+
+	timings struct {
+		mu     sync.Mutex
+		phases map[string]*PhaseTiming
+		order  []string
+	}
+)
+
+// WithTimingReport writes table of per phase timings to w when context passed to bootstrap is cancelled.
+func WithTimingReport(w io.Writer) Option {
+	return func(c *config) {
+		c.timingReport = w
+	}
+}
+
+// WithTimingReportFile writes timings as JSON to file when context passed to bootstrap is cancelled.
+func WithTimingReportFile(path string) Option {
+	return func(c *config) {
+		c.timingReportFile = path
+	}
+}
+
+func (p PhaseTiming) Avg() time.Duration {
+	if p.Count == 0 {
+		return 0
+	}
+
+	return p.Total / time.Duration(p.Count)
+}
+
+func (r TimingReport) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, "PHASE\tCOUNT\tTOTAL\tAVG\tMIN\tMAX")
+	for _, p := range r.Phases {
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\n",
+			p.Phase, p.Count,
+			p.Total.Round(time.Millisecond),
+			p.Avg().Round(time.Millisecond),
+			p.Min.Round(time.Millisecond),
+			p.Max.Round(time.Millisecond),
+		)
+	}
+
+	return tw.Flush()
+}
+
+func newTimings(cfg config) *timings {
+	if cfg.timingReport == nil && cfg.timingReportFile == "" {
+		return nil
+	}
+
+	return &timings{phases: make(map[string]*PhaseTiming)}
+}
+
+func (t *timings) record(phase string, duration time.Duration) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.phases[phase]
+	if !ok {
+		p = &PhaseTiming{Phase: phase, Min: duration}
+		t.phases[phase] = p
+		t.order = append(t.order, phase)
+	}
+
+	p.Count++
+	p.Total += duration
+	p.Min = min(p.Min, duration)
+	p.Max = max(p.Max, duration)
+}
+
+func (t *timings) since(phase string, startedAt time.Time) {
+	t.record(phase, time.Since(startedAt))
+}
+
+func (t *timings) report() TimingReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	res := TimingReport{Phases: make([]PhaseTiming, 0, len(t.order))}
+	for _, phase := range t.order {
+		res.Phases = append(res.Phases, *t.phases[phase])
+	}
+
+	return res
+}
+
+// containerHooks splits container run into image pull and start phases, pre create hooks are called
+// by testcontainers after image is pulled.
+func (t *timings) containerHooks(startedAt *time.Time) testcontainers.CustomizeRequestOption {
+	var createdAt time.Time
+
+	return testcontainers.WithAdditionalLifecycleHooks(testcontainers.ContainerLifecycleHooks{
+		PreCreates: []testcontainers.ContainerRequestHook{
+			func(ctx context.Context, req testcontainers.ContainerRequest) error {
+				createdAt = time.Now()
+				t.record(PhaseContainerPull, createdAt.Sub(*startedAt))
+
+				return nil
+			},
+		},
+		PostReadies: []testcontainers.ContainerHook{
+			func(ctx context.Context, container testcontainers.Container) error {
+				t.since(PhaseContainerStart, createdAt)
+
+				return nil
+			},
+		},
+	})
+}
+
+func (t *timings) reportOnDone(ctx context.Context, cfg config) {
+	if t == nil {
+		return
+	}
+
+	ctxgroup.IncAt(ctx)
+
+	go func() {
+		defer ctxgroup.DoneFrom(ctx)
+
+		<-ctx.Done()
+
+		if err := t.write(cfg); err != nil {
+			cfg.log().Error("can't write timing report", slog.Any("error", err))
+		}
+	}()
+}
+
+func (t *timings) write(cfg config) error {
+	report := t.report()
+
+	if cfg.timingReport != nil {
+		if err := report.WriteTable(cfg.timingReport); err != nil {
+			return fmt.Errorf("can't write timing table: %w", err)
+		}
+	}
+
+	if cfg.timingReportFile != "" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("can't encode timing report: %w", err)
+		}
+
+		if err := afero.WriteFile(cfg.fs, cfg.timingReportFile, data, timingReportFileMode); err != nil {
+			return fmt.Errorf("can't write timing report file: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package groclick
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/godepo/groat/pkg/ctxgroup"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestTimings(t *testing.T) {
+	t.Run("should be able to aggregate phases", func(t *testing.T) {
+		tm := newTimings(config{timingReportFile: "/report.json"})
+
+		tm.record(PhaseDatabaseCreate, 3*time.Second)
+		tm.record(PhaseMigrate, time.Second)
+		tm.record(PhaseDatabaseCreate, time.Second)
+
+		report := tm.report()
+		require.Len(t, report.Phases, 2)
+		assert.Equal(t, PhaseTiming{
+			Phase: PhaseDatabaseCreate,
+			Count: 2,
+			Total: 4 * time.Second,
+			Min:   time.Second,
+			Max:   3 * time.Second,
+		}, report.Phases[0])
+		assert.Equal(t, 2*time.Second, report.Phases[0].Avg())
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, report.WriteTable(buf))
+		assert.Contains(t, buf.String(), "PHASE")
+		assert.Contains(t, buf.String(), "database.create   2      4s     2s   1s   3s")
+	})
+
+	t.Run("should be able to skip when disabled", func(t *testing.T) {
+		var tm *timings
+
+		assert.Nil(t, newTimings(config{}))
+		tm.record(PhaseConnect, time.Second)
+		tm.reportOnDone(t.Context(), config{})
+	})
+
+	t.Run("should be able to report when context is done", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		table := &bytes.Buffer{}
+		cfg := config{fs: fs, timingReport: table, timingReportFile: "/report.json"}
+
+		wg := &sync.WaitGroup{}
+		ctx, cancel := context.WithCancel(ctxgroup.WithWaitGroup(t.Context(), wg))
+
+		tm := newTimings(cfg)
+		tm.reportOnDone(ctx, cfg)
+		tm.record(PhaseConnect, time.Millisecond)
+
+		cancel()
+		wg.Wait()
+
+		assert.Contains(t, table.String(), PhaseConnect)
+
+		data, err := afero.ReadFile(fs, "/report.json")
+		require.NoError(t, err)
+
+		var report TimingReport
+		require.NoError(t, json.Unmarshal(data, &report))
+		assert.Equal(t, []PhaseTiming{{
+			Phase: PhaseConnect, Count: 1, Total: time.Millisecond, Min: time.Millisecond, Max: time.Millisecond,
+		}}, report.Phases)
+	})
+
+	t.Run("should be able to split container phases", func(t *testing.T) {
+		tm := newTimings(config{timingReportFile: "/report.json"})
+		startedAt := time.Now()
+
+		req := testcontainers.GenericContainerRequest{}
+		require.NoError(t, tm.containerHooks(&startedAt).Customize(&req))
+		require.Len(t, req.LifecycleHooks, 1)
+
+		hooks := req.LifecycleHooks[0]
+		require.NoError(t, hooks.PreCreates[0](t.Context(), req.ContainerRequest))
+		require.NoError(t, hooks.PostReadies[0](t.Context(), nil))
+
+		report := tm.report()
+		require.Len(t, report.Phases, 2)
+		assert.Equal(t, PhaseContainerPull, report.Phases[0].Phase)
+		assert.Equal(t, PhaseContainerStart, report.Phases[1].Phase)
+	})
+
+	t.Run("should be able to time database lifecycle", func(t *testing.T) {
+		root := NewMockConn(t)
+		conn := NewMockConn(t)
+		tm := newTimings(config{timingReportFile: "/report.json"})
+
+		fork := newForker(t.Context(), root, isolationDSN, "", config{
+			runID: "run",
+			connConstructor: func(opt *clickhouse.Options) (driver.Conn, error) {
+				return conn, nil
+			},
+			migrator: func(ctx context.Context, migratorConfig MigratorConfig) error {
+				return nil
+			},
+		})
+		fork.timings = tm
+
+		root.EXPECT().Exec(mock.Anything, mock.Anything).Return(nil)
+		conn.EXPECT().Ping(mock.Anything).Return(nil)
+
+		cfg := fork.fork(t, "", nil, nil).primary().cfg
+		require.NoError(t, fork.drop(t.Context(), cfg.Auth.Database))
+
+		phases := make([]string, 0)
+		for _, phase := range tm.report().Phases {
+			phases = append(phases, phase.Phase)
+		}
+		assert.Equal(t, []string{PhaseDatabaseCreate, PhaseMigrate, PhaseDrop}, phases)
+	})
+}
@@ -0,0 +1,246 @@
+package groclick
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/testcontainers/testcontainers-go"
+)
+
+const (
+	containerTLSPort       = "9440/tcp"
+	containerHTTPSPort     = "8443/tcp"
+	containerTLSServerName = "localhost"
+	containerCertsDir      = "/etc/clickhouse-server/certs"
+	containerTLSConfigPath = "/etc/clickhouse-server/config.d/groclick-tls.xml"
+	selfSignedValidity     = 24 * time.Hour
+	selfSignedSerialBits   = 128
+	certFileMode           = 0o644
+)
+
+const containerTLSConfig = `<clickhouse>
+    <https_port>8443</https_port>
+    <tcp_port_secure>9440</tcp_port_secure>
+    <openSSL>
+        <server>
+            <certificateFile>` + containerCertsDir + `/server.crt</certificateFile>
+            <privateKeyFile>` + containerCertsDir + `/server.key</privateKeyFile>
+            <verificationMode>none</verificationMode>
+            <loadDefaultCAFile>false</loadDefaultCAFile>
+            <cacheSessions>true</cacheSessions>
+            <disableProtocols>sslv2,sslv3</disableProtocols>
+            <preferServerCiphers>true</preferServerCiphers>
+        </server>
+    </openSSL>
+</clickhouse>
+`
+
+var ErrInvalidCABundle = errors.New("can't find any certificate in CA bundle")
+
+type selfSignedTLS struct {
+	caPEM   []byte
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func WithTLSCA(path string) Option {
+	return func(c *config) {
+		c.tlsCAFile = path
+	}
+}
+
+func WithTLSClientCert(certPath, keyPath string) Option {
+	return func(c *config) {
+		c.tlsCertFile = certPath
+		c.tlsKeyFile = keyPath
+	}
+}
+
+func WithTLSServerName(name string) Option {
+	return func(c *config) {
+		c.tlsServerName = name
+	}
+}
+
+func WithContainerTLS() Option {
+	return func(c *config) {
+		c.containerTLS = true
+	}
+}
+
+func (c config) tlsConfig(extraCA []byte) (*tls.Config, error) {
+	if c.tlsCAFile == "" && c.tlsCertFile == "" && c.tlsServerName == "" && len(extraCA) == 0 {
+		return nil, nil //nolint:nilnil
+	}
+
+	res := &tls.Config{
+		ServerName: c.tlsServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if c.tlsCAFile != "" || len(extraCA) > 0 {
+		bundle := bytes.Clone(extraCA)
+
+		if c.tlsCAFile != "" {
+			data, err := readFile(c.fs, c.tlsCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("can't read CA bundle: %w", err)
+			}
+			bundle = append(bundle, data...)
+		}
+
+		res.RootCAs = x509.NewCertPool()
+		if !res.RootCAs.AppendCertsFromPEM(bundle) {
+			return nil, ErrInvalidCABundle
+		}
+	}
+
+	if c.tlsCertFile != "" {
+		certPEM, err := readFile(c.fs, c.tlsCertFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read client certificate: %w", err)
+		}
+
+		keyPEM, err := readFile(c.fs, c.tlsKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't read client key: %w", err)
+		}
+
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("can't load client certificate: %w", err)
+		}
+		res.Certificates = []tls.Certificate{cert}
+	}
+
+	return res, nil
+}
+
+func newSelfSignedTLS(now time.Time) (*selfSignedTLS, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("can't generate CA key: %w", err)
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          newSerialNumber(),
+		Subject:               pkix.Name{CommonName: "groclick test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("can't create CA certificate: %w", err)
+	}
+
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("can't generate server key: %w", err)
+	}
+
+	serverTemplate := &x509.Certificate{
+		SerialNumber: newSerialNumber(),
+		Subject:      pkix.Name{CommonName: containerTLSServerName},
+		DNSNames:     []string{containerTLSServerName},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(selfSignedValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	serverDER, err := x509.CreateCertificate(rand.Reader, serverTemplate, caTemplate, &serverKey.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("can't create server certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(serverKey)
+	if err != nil {
+		return nil, fmt.Errorf("can't marshal server key: %w", err)
+	}
+
+	return &selfSignedTLS{
+		caPEM:   pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverDER}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+	}, nil
+}
+
+func (s *selfSignedTLS) customizer() testcontainers.CustomizeRequestOption {
+	return func(req *testcontainers.GenericContainerRequest) error {
+		req.ExposedPorts = append(req.ExposedPorts, containerTLSPort, containerHTTPSPort)
+		req.Files = append(req.Files,
+			testcontainers.ContainerFile{
+				Reader:            bytes.NewReader(s.certPEM),
+				ContainerFilePath: containerCertsDir + "/server.crt",
+				FileMode:          certFileMode,
+			},
+			testcontainers.ContainerFile{
+				Reader:            bytes.NewReader(s.keyPEM),
+				ContainerFilePath: containerCertsDir + "/server.key",
+				FileMode:          certFileMode,
+			},
+			testcontainers.ContainerFile{
+				Reader:            bytes.NewBufferString(containerTLSConfig),
+				ContainerFilePath: containerTLSConfigPath,
+				FileMode:          certFileMode,
+			},
+		)
+
+		return nil
+	}
+}
+
+func applyTLS(opts *clickhouse.Options, tlsCfg *tls.Config) {
+	if tlsCfg == nil {
+		return
+	}
+
+	res := tlsCfg.Clone()
+	if opts.TLS != nil {
+		res.InsecureSkipVerify = opts.TLS.InsecureSkipVerify
+	}
+
+	opts.TLS = res
+}
+
+func secureConnString(connString, endpoint string) (string, error) {
+	dsn, err := url.Parse(connString)
+	if err != nil {
+		return "", fmt.Errorf("can't parse connection string: %w", err)
+	}
+
+	dsn.Host = endpoint
+
+	query := dsn.Query()
+	query.Set("secure", "true")
+	dsn.RawQuery = query.Encode()
+
+	return dsn.String(), nil
+}
+
+func newSerialNumber() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), selfSignedSerialBits))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+
+	return serial
+}
@@ -0,0 +1,62 @@
+package groclick
+
+import (
+	"context"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/godepo/groclick"
+
+// WithTracerProvider enables spans for container start, connections, database lifecycle and migrations.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = provider
+	}
+}
+
+// Context links queries executed with returned context to span from ctx, so server side
+// system.opentelemetry_span_log records belong to the same trace.
+func (c *Connect) Context(ctx context.Context) context.Context {
+	return withSpanContext(ctx)
+}
+
+func (c config) tracer() trace.Tracer {
+	if c.tracerProvider == nil {
+		return noop.NewTracerProvider().Tracer(tracerName)
+	}
+
+	return c.tracerProvider.Tracer(tracerName)
+}
+
+func withSpanContext(ctx context.Context) context.Context {
+	span := trace.SpanContextFromContext(ctx)
+	if !span.IsValid() {
+		return ctx
+	}
+
+	return clickhouse.Context(ctx, clickhouse.WithSpan(span))
+}
+
+// startSpan starts child span using tracer provider of parent span, so code without access to config,
+// like migrators, produces spans only when tracing is enabled.
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx, span := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName).Start(
+		ctx, name, trace.WithAttributes(attrs...),
+	)
+
+	return withSpanContext(ctx), span
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
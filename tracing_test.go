@@ -0,0 +1,105 @@
+package groclick
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func spanNames(recorder *tracetest.SpanRecorder) []string {
+	res := make([]string, 0)
+
+	for _, span := range recorder.Ended() {
+		res = append(res, span.Name())
+	}
+
+	return res
+}
+
+func TestTracing(t *testing.T) {
+	t.Run("should be able to trace database fork and migrations", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+		fs := afero.NewMemMapFs()
+		require.NoError(t, afero.WriteFile(fs, "/migrations/001_init.sql", []byte("CREATE TABLE t (id UInt8)"), 0o644))
+
+		mig, err := PlainMigrator(fs, "/migrations")
+		require.NoError(t, err)
+
+		root := NewMockConn(t)
+		conn := NewMockConn(t)
+
+		fork := newForker(t.Context(), root, isolationDSN, "", config{
+			runID:          "run",
+			tracerProvider: provider,
+			migrator:       mig,
+			connConstructor: func(opt *clickhouse.Options) (driver.Conn, error) {
+				return conn, nil
+			},
+		})
+
+		root.EXPECT().Exec(mock.Anything, mock.Anything).Return(nil)
+		conn.EXPECT().Ping(mock.Anything).Return(nil)
+		conn.EXPECT().
+			Exec(mock.Anything, "CREATE TABLE t (id UInt8)").
+			RunAndReturn(func(ctx context.Context, query string, args ...any) error {
+				assert.True(t, trace.SpanContextFromContext(ctx).IsValid())
+				return nil
+			})
+
+		cfg := fork.fork(t, "", nil, nil).primary().cfg
+		require.NoError(t, fork.drop(t.Context(), cfg.Auth.Database))
+
+		assert.Equal(t, []string{
+			"groclick.database.create",
+			"groclick.connect",
+			"groclick.migration.statement",
+			"groclick.migration",
+			"groclick.migrate",
+			"groclick.database.fork",
+			"groclick.database.drop",
+		}, spanNames(recorder))
+	})
+
+	t.Run("should be able to record errors", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+		root := NewMockConn(t)
+		root.EXPECT().Exec(mock.Anything, mock.Anything).Return(assert.AnError)
+
+		fork := newForker(t.Context(), root, isolationDSN, "", config{tracerProvider: provider})
+
+		require.Error(t, fork.drop(t.Context(), "groclick"))
+		require.Len(t, recorder.Ended(), 1)
+		assert.Len(t, recorder.Ended()[0].Events(), 1)
+	})
+
+	t.Run("should be able to skip spans without provider", func(t *testing.T) {
+		ctx, span := startSpan(t.Context(), "groclick.noop")
+		defer span.End()
+
+		assert.False(t, span.SpanContext().IsValid())
+		assert.False(t, trace.SpanContextFromContext(ctx).IsValid())
+	})
+
+	t.Run("should be able to propagate span context to clickhouse", func(t *testing.T) {
+		provider := sdktrace.NewTracerProvider()
+		ctx, span := provider.Tracer(tracerName).Start(t.Context(), "test")
+		defer span.End()
+
+		res := (&Connect{}).Context(ctx)
+		assert.NotEqual(t, ctx, res)
+		assert.Equal(t, t.Context(), (&Connect{}).Context(t.Context()))
+	})
+}